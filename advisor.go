@@ -0,0 +1,385 @@
+package querybuilder
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// reasons that conditions are flagged by the IndexAdvisor
+const (
+	reasonNegation = "negations match most index keys and can not use an index selectively"
+	reasonRegex    = "regular expressions that are not anchored to the beginning of the value can not use an index efficiently"
+)
+
+// IndexAdvisor records the shapes of the queries built by QueryBuilders and
+// recommends compound indexes for them following the equality, sort, range
+// (ESR) rule... an IndexAdvisor is safe for concurrent use
+type IndexAdvisor struct {
+	mu       sync.Mutex
+	indexes  map[string]*IndexRecommendation
+	warnings map[string]*IndexWarning
+}
+
+// IndexRecommendation is a compound index recommended for a collection, along
+// with the number of recorded queries that the index supports
+type IndexRecommendation struct {
+	Collection string
+	Keys       bson.D
+	Queries    int
+}
+
+// IndexWarning flags a condition on a field that can not use an index well
+// (i.e. $ne or a regular expression that is not anchored), along with the
+// number of recorded queries that include the condition
+type IndexWarning struct {
+	Collection string
+	Field      string
+	Operator   string
+	Reason     string
+	Queries    int
+}
+
+// NewIndexAdvisor returns a new IndexAdvisor with no recorded queries
+func NewIndexAdvisor() *IndexAdvisor {
+	return &IndexAdvisor{
+		indexes:  map[string]*IndexRecommendation{},
+		warnings: map[string]*IndexWarning{},
+	}
+}
+
+// Record records the shape of the query that the QueryBuilder builds for the
+// query options (the fields and operators of the filter, including any scopes,
+// and the sort)
+func (a *IndexAdvisor) Record(qb QueryBuilder, qo queryoptions.Options) error {
+	return a.RecordContext(context.Background(), qb, qo)
+}
+
+// RecordContext records the shape of the query in the same manner as Record,
+// applying any field policy configured for the QueryBuilder to the caller
+// identified by the provided context
+func (a *IndexAdvisor) RecordContext(ctx context.Context, qb QueryBuilder, qo queryoptions.Options) error {
+	node, err := qb.rewriteContext(ctx, qo)
+	if err != nil {
+		return err
+	}
+
+	// mandatory scopes (i.e. the tenant) are part of every query
+	scopes, err := qb.scopeNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(scopes) > 0 {
+		node = Group{Operator: "$and", Nodes: append([]Node{node}, scopes...)}
+	}
+
+	opts, err := qb.FindOptionsContext(ctx, qo)
+	if err != nil {
+		return err
+	}
+
+	// only fields sorted in a direction can use an index (not relevance)
+	sortKeys := bson.D{}
+	if keys, ok := opts.Sort.(bson.D); ok {
+		for _, e := range keys {
+			if _, ok := e.Value.(int); ok {
+				sortKeys = append(sortKeys, e)
+			}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	flagged := map[string]bool{}
+	recommended := map[string]bool{}
+
+	// each alternative of an $or is a separate query plan requiring an index
+	for _, conditions := range alternatives(node) {
+		keys, warnings := indexKeys(conditions, sortKeys)
+
+		for _, w := range warnings {
+			key := strings.Join([]string{qb.collection, w.Field, w.Operator}, "\x00")
+			if flagged[key] {
+				continue
+			}
+			flagged[key] = true
+
+			if existing, ok := a.warnings[key]; ok {
+				existing.Queries++
+				continue
+			}
+
+			warning := w
+			warning.Collection = qb.collection
+			warning.Queries = 1
+			a.warnings[key] = &warning
+		}
+
+		if len(keys) == 0 {
+			continue
+		}
+
+		key := qb.collection + "\x00" + renderShell(keys)
+		if recommended[key] {
+			continue
+		}
+		recommended[key] = true
+
+		if existing, ok := a.indexes[key]; ok {
+			existing.Queries++
+			continue
+		}
+
+		a.indexes[key] = &IndexRecommendation{
+			Collection: qb.collection,
+			Keys:       keys,
+			Queries:    1,
+		}
+	}
+
+	return nil
+}
+
+// Recommendations returns the recommended indexes, ordered by the number of
+// recorded queries each supports... indexes whose keys are a prefix of another
+// recommended index are omitted, as the longer index supports their queries
+func (a *IndexAdvisor) Recommendations() []IndexRecommendation {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	candidates := []IndexRecommendation{}
+	for _, r := range a.indexes {
+		candidates = append(candidates, *r)
+	}
+
+	// consider the longest indexes first so that prefixes can be merged
+	sort.Slice(candidates, func(i, j int) bool {
+		if len(candidates[i].Keys) != len(candidates[j].Keys) {
+			return len(candidates[i].Keys) > len(candidates[j].Keys)
+		}
+
+		return renderShell(candidates[i].Keys) < renderShell(candidates[j].Keys)
+	})
+
+	recommendations := []IndexRecommendation{}
+	for _, c := range candidates {
+		merged := false
+		for i, r := range recommendations {
+			if r.Collection == c.Collection && isKeyPrefix(c.Keys, r.Keys) {
+				recommendations[i].Queries += c.Queries
+				merged = true
+				break
+			}
+		}
+
+		if !merged {
+			recommendations = append(recommendations, c)
+		}
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		if recommendations[i].Queries != recommendations[j].Queries {
+			return recommendations[i].Queries > recommendations[j].Queries
+		}
+
+		if recommendations[i].Collection != recommendations[j].Collection {
+			return recommendations[i].Collection < recommendations[j].Collection
+		}
+
+		return renderShell(recommendations[i].Keys) < renderShell(recommendations[j].Keys)
+	})
+
+	return recommendations
+}
+
+// IndexModels returns the recommended indexes for the collection as index
+// models suitable for use with the CreateMany method of the Mongo driver
+func (a *IndexAdvisor) IndexModels(collection string) []mongo.IndexModel {
+	models := []mongo.IndexModel{}
+	for _, r := range a.Recommendations() {
+		if r.Collection == collection {
+			models = append(models, mongo.IndexModel{Keys: r.Keys})
+		}
+	}
+
+	return models
+}
+
+// Warnings returns the conditions of the recorded queries that can not use an
+// index well, ordered by the number of recorded queries that include them
+func (a *IndexAdvisor) Warnings() []IndexWarning {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	warnings := []IndexWarning{}
+	for _, w := range a.warnings {
+		warnings = append(warnings, *w)
+	}
+
+	sort.Slice(warnings, func(i, j int) bool {
+		switch {
+		case warnings[i].Queries != warnings[j].Queries:
+			return warnings[i].Queries > warnings[j].Queries
+		case warnings[i].Collection != warnings[j].Collection:
+			return warnings[i].Collection < warnings[j].Collection
+		case warnings[i].Field != warnings[j].Field:
+			return warnings[i].Field < warnings[j].Field
+		}
+
+		return warnings[i].Operator < warnings[j].Operator
+	})
+
+	return warnings
+}
+
+// alternatives returns the conditions of each alternative query plan for the
+// AST: the conditions that apply to every document combined with each of the
+// alternatives of any $or groups
+func alternatives(node Node) [][]Condition {
+	plans := [][]Condition{{}}
+
+	switch n := node.(type) {
+	case Condition:
+		return [][]Condition{{n}}
+	case Group:
+		switch n.Operator {
+		case "$or":
+			plans = [][]Condition{}
+			for _, child := range n.Nodes {
+				plans = append(plans, alternatives(child)...)
+			}
+		case "$nor":
+			// conditions that must not match are negations
+			negated := []Condition{}
+			for _, child := range n.Nodes {
+				for _, conditions := range alternatives(child) {
+					for _, c := range conditions {
+						c.Operator = "$not"
+						negated = append(negated, c)
+					}
+				}
+			}
+			plans = [][]Condition{negated}
+		default:
+			for _, child := range n.Nodes {
+				alts := alternatives(child)
+				if len(alts) == 0 {
+					continue
+				}
+
+				combined := [][]Condition{}
+				for _, plan := range plans {
+					for _, conditions := range alts {
+						c := append(append([]Condition{}, plan...), conditions...)
+						combined = append(combined, c)
+					}
+				}
+				plans = combined
+			}
+		}
+	}
+
+	return plans
+}
+
+// indexKeys returns the keys of the index for the conditions and sort
+// following the ESR rule: fields compared for equality, then the sort fields
+// and then fields compared with a range... conditions that can not use an
+// index well are returned as warnings
+func indexKeys(conditions []Condition, sortKeys bson.D) (bson.D, []IndexWarning) {
+	equality := map[string]bool{}
+	ranges := map[string]bool{}
+	warnings := []IndexWarning{}
+
+	var classify func(prefix string, conditions []Condition)
+	classify = func(prefix string, conditions []Condition) {
+		for _, c := range conditions {
+			if c.Field == "" {
+				continue
+			}
+
+			field := prefix + c.Field
+
+			switch c.Operator {
+			case "$eq", "$in", "$all":
+				equality[field] = true
+			case "$gt", "$gte", "$lt", "$lte", "$exists", "$type":
+				ranges[field] = true
+			case "$regex":
+				if re, ok := c.Value.(primitive.Regex); ok && !strings.HasPrefix(re.Pattern, "^") {
+					warnings = append(warnings, IndexWarning{Field: field, Operator: c.Operator, Reason: reasonRegex})
+					continue
+				}
+				ranges[field] = true
+			case "$ne", "$nin", "$not":
+				warnings = append(warnings, IndexWarning{Field: field, Operator: c.Operator, Reason: reasonNegation})
+			case "$elemMatch":
+				// the fields of the elements are indexed with a multikey index
+				if inner, ok := c.Value.(Node); ok {
+					if plans := alternatives(inner); len(plans) > 0 {
+						classify(field+".", plans[0])
+					}
+				}
+			}
+		}
+	}
+	classify("", conditions)
+
+	keys := bson.D{}
+	included := map[string]bool{}
+
+	for _, field := range sortedFields(equality) {
+		keys = append(keys, primitive.E{Key: field, Value: 1})
+		included[field] = true
+	}
+
+	for _, e := range sortKeys {
+		if !included[e.Key] {
+			keys = append(keys, e)
+			included[e.Key] = true
+		}
+	}
+
+	for _, field := range sortedFields(ranges) {
+		if !included[field] {
+			keys = append(keys, primitive.E{Key: field, Value: 1})
+			included[field] = true
+		}
+	}
+
+	return keys, warnings
+}
+
+// isKeyPrefix determines if the keys of an index are a prefix of the keys of
+// another (longer) index
+func isKeyPrefix(prefix bson.D, keys bson.D) bool {
+	if len(prefix) >= len(keys) {
+		return false
+	}
+
+	for i, e := range prefix {
+		if keys[i].Key != e.Key || keys[i].Value != e.Value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortedFields(fields map[string]bool) []string {
+	sorted := []string{}
+	for field := range fields {
+		sorted = append(sorted, field)
+	}
+	sort.Strings(sorted)
+
+	return sorted
+}
@@ -0,0 +1,190 @@
+package querybuilder
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestIndexAdvisor_Recommendations(t *testing.T) {
+	qb := QueryBuilder{
+		collection: "things",
+		fieldTypes: map[string]string{
+			"age":     "int",
+			"created": "date",
+			"name":    "string",
+			"status":  "string",
+			"type":    "string",
+		},
+	}
+
+	tests := []struct {
+		name string
+		qs   []string
+		want []IndexRecommendation
+	}{
+		{
+			name: "should order equality, sort and range fields",
+			qs:   []string{"filter[age]=>18&filter[status]=active&sort=-created"},
+			want: []IndexRecommendation{
+				{Collection: "things", Keys: bson.D{{Key: "status", Value: 1}, {Key: "created", Value: -1}, {Key: "age", Value: 1}}, Queries: 1},
+			},
+		},
+		{
+			name: "should treat $in and anchored regular expressions as equality and range",
+			qs:   []string{"filter[type]=a,b&filter[name]=bas*"},
+			want: []IndexRecommendation{
+				{Collection: "things", Keys: bson.D{{Key: "type", Value: 1}, {Key: "name", Value: 1}}, Queries: 1},
+			},
+		},
+		{
+			name: "should count queries with the same shape",
+			qs: []string{
+				"filter[status]=active&sort=name",
+				"filter[status]=inactive&sort=name",
+				"filter[type]=a",
+			},
+			want: []IndexRecommendation{
+				{Collection: "things", Keys: bson.D{{Key: "status", Value: 1}, {Key: "name", Value: 1}}, Queries: 2},
+				{Collection: "things", Keys: bson.D{{Key: "type", Value: 1}}, Queries: 1},
+			},
+		},
+		{
+			name: "should merge indexes that are a prefix of another",
+			qs: []string{
+				"filter[status]=active",
+				"filter[status]=active&sort=name",
+			},
+			want: []IndexRecommendation{
+				{Collection: "things", Keys: bson.D{{Key: "status", Value: 1}, {Key: "name", Value: 1}}, Queries: 2},
+			},
+		},
+		{
+			name: "should recommend an index for each alternative",
+			qs:   []string{"filter[age]=>18&filter[status]=||active&filter[type]=||a"},
+			want: []IndexRecommendation{
+				{Collection: "things", Keys: bson.D{{Key: "status", Value: 1}, {Key: "age", Value: 1}}, Queries: 1},
+				{Collection: "things", Keys: bson.D{{Key: "type", Value: 1}, {Key: "age", Value: 1}}, Queries: 1},
+			},
+		},
+		{
+			name: "should not index fields that can not use an index well",
+			qs:   []string{"filter[name]=*bas*&filter[status]=!=active"},
+			want: []IndexRecommendation{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			advisor := NewIndexAdvisor()
+			for _, qs := range tt.qs {
+				qo, err := queryoptions.FromQuerystring(qs)
+				if err != nil {
+					t.Errorf("options.FromQuerystring() error = %v", err)
+					return
+				}
+
+				if err := advisor.Record(qb, qo); err != nil {
+					t.Errorf("IndexAdvisor.Record() error = %v", err)
+					return
+				}
+			}
+
+			if got := advisor.Recommendations(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("IndexAdvisor.Recommendations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexAdvisor_Warnings(t *testing.T) {
+	qb := QueryBuilder{
+		collection: "things",
+		fieldTypes: map[string]string{
+			"active": "bool",
+			"name":   "string",
+			"status": "string",
+		},
+	}
+
+	advisor := NewIndexAdvisor()
+	for _, qs := range []string{
+		"filter[name]=*bas*&filter[status]=!=active",
+		"filter[name]=*ket&filter[active]=-true,-null",
+		"filter[name]=bas*",
+	} {
+		qo, err := queryoptions.FromQuerystring(qs)
+		if err != nil {
+			t.Errorf("options.FromQuerystring() error = %v", err)
+			return
+		}
+
+		if err := advisor.Record(qb, qo); err != nil {
+			t.Errorf("IndexAdvisor.Record() error = %v", err)
+			return
+		}
+	}
+
+	want := []IndexWarning{
+		{Collection: "things", Field: "name", Operator: "$regex", Reason: reasonRegex, Queries: 2},
+		{Collection: "things", Field: "active", Operator: "$nin", Reason: reasonNegation, Queries: 1},
+		{Collection: "things", Field: "status", Operator: "$ne", Reason: reasonNegation, Queries: 1},
+	}
+	if got := advisor.Warnings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("IndexAdvisor.Warnings() = %v, want %v", got, want)
+	}
+}
+
+func TestIndexAdvisor_IndexModels(t *testing.T) {
+	advisor := NewIndexAdvisor()
+	for _, qb := range []QueryBuilder{
+		{collection: "things", fieldTypes: map[string]string{"status": "string"}},
+		{collection: "others", fieldTypes: map[string]string{"status": "string"}},
+	} {
+		qo := queryoptions.Options{Filter: map[string][]string{"status": {"active"}}, Sort: []string{"-status"}}
+		if err := advisor.Record(qb, qo); err != nil {
+			t.Errorf("IndexAdvisor.Record() error = %v", err)
+			return
+		}
+	}
+
+	want := []mongo.IndexModel{{Keys: bson.D{{Key: "status", Value: 1}}}}
+	if got := advisor.IndexModels("things"); !reflect.DeepEqual(got, want) {
+		t.Errorf("IndexAdvisor.IndexModels() = %v, want %v", got, want)
+	}
+}
+
+func TestIndexAdvisor_RecordContext(t *testing.T) {
+	qb := (&QueryBuilder{
+		collection: "things",
+		fieldTypes: map[string]string{"status": "string"},
+	}).AddScope(bson.M{"deletedAt": nil}).AddScopeFunc(testTenantScope)
+
+	qo, err := queryoptions.FromQuerystring("filter[status]=x&sort=status")
+	if err != nil {
+		t.Errorf("options.FromQuerystring() error = %v", err)
+		return
+	}
+
+	advisor := NewIndexAdvisor()
+	if err := advisor.RecordContext(context.Background(), *qb, qo); err == nil {
+		t.Errorf("IndexAdvisor.RecordContext() error = %v, wantErr %v", err, true)
+		return
+	}
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, "a")
+	if err := advisor.RecordContext(ctx, *qb, qo); err != nil {
+		t.Errorf("IndexAdvisor.RecordContext() error = %v", err)
+		return
+	}
+
+	want := []IndexRecommendation{
+		{Collection: "things", Keys: bson.D{{Key: "deletedAt", Value: 1}, {Key: "status", Value: 1}, {Key: "tenantId", Value: 1}}, Queries: 1},
+	}
+	if got := advisor.Recommendations(); !reflect.DeepEqual(got, want) {
+		t.Errorf("IndexAdvisor.Recommendations() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,127 @@
+package querybuilder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SetArrayField marks a field as an array (of items of the provided bson type)
+// for schemas that do not describe the field, enabling the array modifiers and
+// positional paths (i.e. tags.0) for it. Array fields in the schema are
+// discovered automatically.
+func (qb *QueryBuilder) SetArrayField(field string, itemType string) *QueryBuilder {
+	if qb.arrayFields == nil {
+		qb.arrayFields = map[string]bool{}
+	}
+
+	if qb.fieldTypes == nil {
+		qb.fieldTypes = map[string]string{}
+	}
+
+	stored := qb.storedField(field)
+	qb.arrayFields[stored] = true
+	qb.fieldTypes[stored] = itemType
+
+	return qb
+}
+
+// isArrayField determines whether the stored field is an array
+func (qb QueryBuilder) isArrayField(stored string) bool {
+	return qb.arrayFields[stored] || qb.fieldTypes[stored] == "array"
+}
+
+// trimPositions removes positions (i.e. the 0 in tags.0) that follow array
+// fields from the public field name so that the type of the items is used
+func (qb QueryBuilder) trimPositions(public string) string {
+	segments := strings.Split(public, ".")
+	path := []string{}
+
+	for i, segment := range segments {
+		if _, err := strconv.Atoi(segment); err == nil && i > 0 &&
+			qb.isArrayField(qb.storedField(strings.Join(path, "."))) {
+			continue
+		}
+
+		path = append(path, segment)
+	}
+
+	return strings.Join(path, ".")
+}
+
+// isAllFilter determines whether the values use the {} prefix to require all
+// values to be present in an array
+func isAllFilter(values []string) bool {
+	for _, value := range values {
+		if strings.HasPrefix(value, "{}") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// detectAllOperator builds an $all condition with each of the values
+// converted to the type of the items within the array
+func (qb QueryBuilder) detectAllOperator(name string, field string, values []string, bsonType string) ([]Node, error) {
+	a := bson.A{}
+
+	for _, value := range values {
+		value = strings.TrimPrefix(value, "{}")
+
+		nodes, err := qb.detectComparisonOperator(name, field, []string{value}, bsonType, "")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, n := range nodes {
+			if c, ok := n.(Condition); ok && c.Field == field {
+				a = append(a, compileOperand([]Condition{c}))
+			}
+		}
+	}
+
+	return []Node{Condition{Field: field, Operator: "$all", Value: a}}, nil
+}
+
+// detectEmptyOperator builds a condition matching arrays that are empty (or
+// missing) when true and arrays with at least one item when false
+func detectEmptyOperator(field string, values []string) ([]Node, error) {
+	empty, err := parseModifierBool(field, values)
+	if err != nil {
+		return nil, err
+	}
+
+	if empty {
+		return []Node{Condition{Field: field, Operator: "$in", Value: bson.A{nil, bson.A{}}}}, nil
+	}
+
+	return []Node{Condition{Field: fmt.Sprintf("%s.0", field), Operator: "$exists", Value: true}}, nil
+}
+
+// detectSizeOperator builds a $size condition for an exact number of items,
+// or an $expr comparing the number of items when an operator is provided
+func detectSizeOperator(field string, values []string) ([]Node, error) {
+	// sizes must be whole numbers that are not negative
+	for _, value := range values {
+		if size, err := strconv.Atoi(trimComparisonPrefix(value)); err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid size %s to filter field %s", value, field)
+		}
+	}
+
+	nodes := detectNumericComparisonOperator(field, values, "int")
+	if nodes == nil {
+		return nil, nil
+	}
+
+	if c, ok := nodes[0].(Condition); ok && len(nodes) == 1 && c.Operator == "$eq" {
+		return []Node{Condition{Field: field, Operator: "$size", Value: c.Value}}, nil
+	}
+
+	// $size does not support ranges... compare the size in an expression
+	size := bson.M{"$size": bson.M{"$ifNull": bson.A{fmt.Sprintf("$%s", field), bson.A{}}}}
+
+	return compareExpr(nodes, size), nil
+}
@@ -0,0 +1,128 @@
+package querybuilder
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestQueryBuilder_SetArrayField(t *testing.T) {
+	d1 := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	d2 := time.Date(2020, time.January, 2, 0, 0, 0, 0, time.UTC)
+	size := bson.M{"$size": bson.M{"$ifNull": bson.A{"$tags", bson.A{}}}}
+
+	tests := []struct {
+		name    string
+		qs      string
+		want    bson.M
+		wantErr bool
+	}{
+		{
+			name: "should use $in for membership of typed items",
+			qs:   "filter[scores]=1,2",
+			want: bson.M{"scores": bson.D{primitive.E{Key: "$in", Value: bson.A{int32(1), int32(2)}}}},
+		},
+		{
+			name: "should use $all with typed items",
+			qs:   "filter[scores:all]=1,2",
+			want: bson.M{"scores": bson.D{primitive.E{Key: "$all", Value: bson.A{int32(1), int32(2)}}}},
+		},
+		{
+			name: "should use $all for values with a {} prefix",
+			qs:   "filter[dates]={}2020-01-01T00:00:00Z,{}2020-01-02T00:00:00Z",
+			want: bson.M{"dates": bson.D{primitive.E{Key: "$all", Value: bson.A{&d1, &d2}}}},
+		},
+		{
+			name: "should use $all for arrays that are not in the schema",
+			qs:   "filter[codes:all]=7",
+			want: bson.M{"codes": bson.D{primitive.E{Key: "$all", Value: bson.A{int64(7)}}}},
+		},
+		{
+			name: "should use $size for an exact number of items",
+			qs:   "filter[tags:size]=3",
+			want: bson.M{"tags": bson.D{primitive.E{Key: "$size", Value: int32(3)}}},
+		},
+		{
+			name: "should use $expr for ranges of sizes",
+			qs:   "filter[tags:size]=>2",
+			want: bson.M{"$expr": bson.M{"$gt": bson.A{size, int32(2)}}},
+		},
+		{
+			name: "should match empty arrays",
+			qs:   "filter[tags:empty]=true",
+			want: bson.M{"tags": bson.D{primitive.E{Key: "$in", Value: bson.A{nil, bson.A{}}}}},
+		},
+		{
+			name: "should match arrays that are not empty",
+			qs:   "filter[tags:empty]=false",
+			want: bson.M{"tags.0": bson.D{primitive.E{Key: "$exists", Value: true}}},
+		},
+		{
+			name: "should use the item type for positional paths",
+			qs:   "filter[scores.0]=>5",
+			want: bson.M{"scores.0": bson.D{primitive.E{Key: "$gt", Value: int32(5)}}},
+		},
+		{
+			name:    "should reject sizes that are not numbers",
+			qs:      "filter[tags:size]=abc",
+			wantErr: true,
+		},
+		{
+			name:    "should reject negative sizes",
+			qs:      "filter[tags:size]=>=-1",
+			wantErr: true,
+		},
+		{
+			name:    "should reject invalid empty values",
+			qs:      "filter[tags:empty]=maybe",
+			wantErr: true,
+		},
+		{
+			name:    "should reject unsupported modifiers",
+			qs:      "filter[tags:first]=a",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := NewQueryBuilder("test", bson.M{
+				"$jsonSchema": bson.M{
+					"properties": bson.M{
+						"dates": bson.M{
+							"bsonType": "array",
+							"items":    bson.M{"bsonType": "date"},
+						},
+						"scores": bson.M{
+							"bsonType": "array",
+							"items":    bson.M{"bsonType": "int"},
+						},
+						"tags": bson.M{
+							"bsonType": "array",
+							"items":    bson.M{"bsonType": "string"},
+						},
+					},
+				},
+			}, true).SetArrayField("codes", "long")
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			got, err := qb.Filter(qo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryBuilder.Filter() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryBuilder.Filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package querybuilder
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Node is a node within the abstract syntax tree (AST) of a filter, either a
+// Condition or a Group of nodes
+type Node interface {
+	compile() bson.M
+}
+
+// Condition compares a field with a typed value using an operator (i.e. $gt).
+// Equality is represented by the $eq operator and regular expressions by the
+// $regex operator, while the value of an $elemMatch condition is the Node that
+// elements of the array must match. Conditions that do not apply to a field
+// (i.e. $expr and $text) have an empty Field.
+type Condition struct {
+	Field    string
+	Operator string
+	Value    interface{}
+}
+
+// Group combines nodes using a boolean operator ($and, $or or $nor)
+type Group struct {
+	Operator string
+	Nodes    []Node
+}
+
+// RewriteRule transforms a node of the AST before it is compiled... returning
+// a nil Node removes the node from the AST
+type RewriteRule func(node Node) (Node, error)
+
+// AddRewriteRule adds a rule that is applied (in the order the rules are
+// added) to each node of the AST parsed by Filter before it is compiled
+func (qb *QueryBuilder) AddRewriteRule(rule RewriteRule) *QueryBuilder {
+	qb.rewriteRules = append(qb.rewriteRules, rule)
+
+	return qb
+}
+
+// rewriteContext parses the filter of the query options into an AST and
+// applies any rewrite rules configured for the QueryBuilder
+func (qb QueryBuilder) rewriteContext(ctx context.Context, qo queryoptions.Options) (Node, error) {
+	node, err := qb.ParseContext(ctx, qo)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range qb.rewriteRules {
+		if node, err = Rewrite(node, rule); err != nil {
+			return nil, err
+		}
+	}
+
+	return node, nil
+}
+
+// Rewrite applies the rule to each node of the AST, beginning with the
+// innermost nodes (including the nodes of $elemMatch conditions)
+func Rewrite(node Node, rule RewriteRule) (Node, error) {
+	switch n := node.(type) {
+	case Group:
+		nodes := []Node{}
+		for _, child := range n.Nodes {
+			child, err := Rewrite(child, rule)
+			if err != nil {
+				return nil, err
+			}
+
+			if child != nil {
+				nodes = append(nodes, child)
+			}
+		}
+		n.Nodes = nodes
+		node = n
+	case Condition:
+		if inner, ok := n.Value.(Node); ok {
+			inner, err := Rewrite(inner, rule)
+			if err != nil {
+				return nil, err
+			}
+
+			// elements must match at least an empty document
+			if inner == nil {
+				inner = Group{Operator: "$and"}
+			}
+			n.Value = inner
+			node = n
+		}
+	}
+
+	return rule(node)
+}
+
+// Compile compiles the AST into a filter suitable for the find methods exposed
+// by the Mongo driver... the conditions on each field of an $and group are
+// compiled into a single value (a lone $eq), regular expression (a lone
+// $regex) or operator document (a bson.D with the operators in the order of
+// the conditions)
+func Compile(node Node) bson.M {
+	g, ok := node.(Group)
+	if !ok {
+		if node == nil {
+			return bson.M{}
+		}
+
+		return node.compile()
+	}
+
+	if g.Operator != "$and" {
+		return g.compile()
+	}
+
+	// the nodes of an $and group are merged into a single document
+	filter := bson.M{}
+	fields := []string{}
+	conditions := map[string][]Condition{}
+	repeated := []Node{}
+
+	for _, n := range g.Nodes {
+		c, ok := n.(Condition)
+		if !ok || c.Field == "" {
+			filter = mergeClause(filter, n.compile())
+			continue
+		}
+
+		if _, ok := conditions[c.Field]; !ok {
+			fields = append(fields, c.Field)
+		}
+
+		// an operator can only be used once within an operator document
+		if hasOperator(conditions[c.Field], c.Operator) {
+			repeated = append(repeated, c)
+			continue
+		}
+
+		conditions[c.Field] = append(conditions[c.Field], c)
+	}
+
+	for _, field := range fields {
+		filter = mergeClause(filter, bson.M{field: compileOperand(conditions[field])})
+	}
+
+	for _, n := range repeated {
+		filter = mergeClause(filter, n.compile())
+	}
+
+	return filter
+}
+
+func (c Condition) compile() bson.M {
+	if c.Field == "" {
+		return bson.M{c.Operator: compileValue(c.Value)}
+	}
+
+	return bson.M{c.Field: compileOperand([]Condition{c})}
+}
+
+func (g Group) compile() bson.M {
+	a := bson.A{}
+	for _, n := range g.Nodes {
+		a = append(a, Compile(n))
+	}
+
+	return bson.M{g.Operator: a}
+}
+
+// compileOperand compiles the conditions on a field to the value or operator
+// document that the field is compared with
+func compileOperand(conditions []Condition) interface{} {
+	if len(conditions) == 1 {
+		c := conditions[0]
+		if c.Operator == "$eq" {
+			return c.Value
+		}
+
+		if re, ok := c.Value.(primitive.Regex); ok && c.Operator == "$regex" {
+			return re
+		}
+	}
+
+	d := bson.D{}
+	for _, c := range conditions {
+		d = append(d, primitive.E{Key: c.Operator, Value: compileValue(c.Value)})
+	}
+
+	return d
+}
+
+func compileValue(v interface{}) interface{} {
+	if n, ok := v.(Node); ok {
+		return Compile(n)
+	}
+
+	return v
+}
+
+func hasOperator(conditions []Condition, operator string) bool {
+	for _, c := range conditions {
+		if c.Operator == operator {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeClause adds the clause to the filter... clauses for keys that already
+// exist in the filter are added to an $and, except for expressions which are
+// combined
+func mergeClause(filter bson.M, clause bson.M) bson.M {
+	for k, v := range clause {
+		existing, ok := filter[k]
+		if !ok {
+			filter[k] = v
+			continue
+		}
+
+		if and, ok := v.(bson.A); ok && k == "$and" {
+			filter[k] = append(existing.(bson.A), and...)
+			continue
+		}
+
+		if k == "$expr" {
+			// expressions must all be true
+			filter[k] = bson.M{"$and": bson.A{existing, v}}
+			continue
+		}
+
+		and, _ := filter["$and"].(bson.A)
+		filter["$and"] = append(and, bson.M{k: v})
+	}
+
+	return filter
+}
+
+// either returns the condition as an alternative (a legacy || filter), which
+// is added to the $or group of the filter
+func either(c Condition) Group {
+	return Group{Operator: "$or", Nodes: []Node{c}}
+}
+
+// parseClause decomposes a clause (i.e. a scope) into nodes
+func parseClause(clause bson.M) []Node {
+	nodes := []Node{}
+
+	for _, key := range sortedKeys(clause) {
+		value := clause[key]
+
+		switch {
+		case key == "$and" || key == "$or" || key == "$nor":
+			g := Group{Operator: key}
+			switch value := value.(type) {
+			case bson.A:
+				for _, v := range value {
+					if m, ok := v.(bson.M); ok {
+						g.Nodes = append(g.Nodes, Group{Operator: "$and", Nodes: parseClause(m)})
+					}
+				}
+			case bson.M:
+				g.Nodes = parseClause(value)
+			}
+			nodes = append(nodes, g)
+		case strings.HasPrefix(key, "$"):
+			nodes = append(nodes, Condition{Operator: key, Value: value})
+		default:
+			nodes = append(nodes, parseOperand(key, value)...)
+		}
+	}
+
+	return nodes
+}
+
+// parseOperand decomposes the value or operator document that a field is
+// compared with into conditions
+func parseOperand(field string, value interface{}) []Node {
+	nodes := []Node{}
+
+	switch value := value.(type) {
+	case bson.D:
+		if isOperatorDocument(value.Map()) {
+			for _, e := range value {
+				nodes = append(nodes, Condition{Field: field, Operator: e.Key, Value: parseValue(e.Key, e.Value)})
+			}
+
+			return nodes
+		}
+	case bson.M:
+		if isOperatorDocument(value) {
+			for _, key := range sortedKeys(value) {
+				nodes = append(nodes, Condition{Field: field, Operator: key, Value: parseValue(key, value[key])})
+			}
+
+			return nodes
+		}
+	case primitive.Regex:
+		return append(nodes, Condition{Field: field, Operator: "$regex", Value: value})
+	}
+
+	return append(nodes, Condition{Field: field, Operator: "$eq", Value: value})
+}
+
+func parseValue(operator string, value interface{}) interface{} {
+	if m, ok := value.(bson.M); ok && operator == "$elemMatch" {
+		return Group{Operator: "$and", Nodes: parseClause(m)}
+	}
+
+	return value
+}
+
+func isOperatorDocument(m bson.M) bool {
+	if len(m) == 0 {
+		return false
+	}
+
+	for key := range m {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortedKeys(m bson.M) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// appendNodes adds the nodes parsed for a filter field to the root of the AST,
+// adding legacy || conditions to a single $or group and grouping $elemMatch
+// conditions for the same array so they bind to the same element
+func appendNodes(root *Group, or *Group, nodes []Node) {
+	for _, n := range nodes {
+		if g, ok := n.(Group); ok && g.Operator == "$or" && len(g.Nodes) > 0 {
+			if _, ok := g.Nodes[0].(Condition); ok {
+				or.Nodes = append(or.Nodes, g.Nodes...)
+				continue
+			}
+		}
+
+		if c, ok := n.(Condition); ok && c.Operator == "$elemMatch" {
+			if i := findElemMatch(root, c.Field); i >= 0 {
+				existing := root.Nodes[i].(Condition)
+				inner := existing.Value.(Group)
+				inner.Nodes = append(inner.Nodes, c.Value.(Group).Nodes...)
+				existing.Value = inner
+				root.Nodes[i] = existing
+				continue
+			}
+		}
+
+		root.Nodes = append(root.Nodes, n)
+	}
+}
+
+func findElemMatch(root *Group, field string) int {
+	for i, n := range root.Nodes {
+		if c, ok := n.(Condition); ok && c.Field == field && c.Operator == "$elemMatch" {
+			if _, ok := c.Value.(Group); ok {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,269 @@
+package querybuilder
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var astFieldTypes = map[string]string{
+	"age":         "int",
+	"name":        "string",
+	"items":       "array",
+	"items.name":  "string",
+	"items.qty":   "int",
+	"internalRef": "string",
+}
+
+func TestQueryBuilder_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		qs      string
+		want    Node
+		wantErr bool
+	}{
+		{
+			name: "should parse typed conditions",
+			qs:   "filter[age]=>=18",
+			want: Group{Operator: "$and", Nodes: []Node{
+				Condition{Field: "age", Operator: "$gte", Value: int32(18)},
+			}},
+		},
+		{
+			name: "should parse ranges into a condition for each operator",
+			qs:   "filter[age]=><18,><65",
+			want: Group{Operator: "$and", Nodes: []Node{
+				Condition{Field: "age", Operator: "$gte", Value: int32(18)},
+				Condition{Field: "age", Operator: "$lte", Value: int32(65)},
+			}},
+		},
+		{
+			name: "should parse regular expressions",
+			qs:   "filter[name]=bob*",
+			want: Group{Operator: "$and", Nodes: []Node{
+				Condition{Field: "name", Operator: "$regex", Value: primitive.Regex{Pattern: "^bob", Options: "im"}},
+			}},
+		},
+		{
+			name: "should parse $elemMatch conditions into a group for the same element",
+			qs:   "filter[items.[*].qty]=>1",
+			want: Group{Operator: "$and", Nodes: []Node{
+				Condition{Field: "items", Operator: "$elemMatch", Value: Group{Operator: "$and", Nodes: []Node{
+					Condition{Field: "qty", Operator: "$gt", Value: int32(1)},
+				}}},
+			}},
+		},
+		{
+			name: "should parse || conditions into an $or group",
+			qs:   "filter[name]=||bob",
+			want: Group{Operator: "$and", Nodes: []Node{
+				Group{Operator: "$or", Nodes: []Node{
+					Condition{Field: "name", Operator: "$eq", Value: "bob"},
+				}},
+			}},
+		},
+		{
+			name: "should parse || conditions with operators into typed conditions",
+			qs:   "filter[age]=||>=18",
+			want: Group{Operator: "$and", Nodes: []Node{
+				Group{Operator: "$or", Nodes: []Node{
+					Condition{Field: "age", Operator: "$gte", Value: int32(18)},
+				}},
+			}},
+		},
+		{
+			name:    "should validate fields",
+			qs:      "filter[unknown]=1",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := QueryBuilder{
+				collection:       "test",
+				fieldTypes:       astFieldTypes,
+				strictValidation: true,
+			}
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			got, err := qb.Parse(qo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryBuilder.Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryBuilder.Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		node Node
+		want bson.M
+	}{
+		{
+			name: "should compile an empty AST",
+			want: bson.M{},
+		},
+		{
+			name: "should compile conditions on the same field into a single document",
+			node: Group{Operator: "$and", Nodes: []Node{
+				Condition{Field: "age", Operator: "$gte", Value: 18},
+				Condition{Field: "age", Operator: "$lte", Value: 65},
+				Condition{Field: "name", Operator: "$eq", Value: "bob"},
+			}},
+			want: bson.M{
+				"age":  bson.D{{Key: "$gte", Value: 18}, {Key: "$lte", Value: 65}},
+				"name": "bob",
+			},
+		},
+		{
+			name: "should compile conditions on the same field that are not adjacent",
+			node: Group{Operator: "$and", Nodes: []Node{
+				Condition{Field: "age", Operator: "$gte", Value: 18},
+				Condition{Field: "name", Operator: "$regex", Value: primitive.Regex{Pattern: "^bob", Options: "im"}},
+				Condition{Field: "age", Operator: "$exists", Value: true},
+			}},
+			want: bson.M{
+				"age":  bson.D{{Key: "$gte", Value: 18}, {Key: "$exists", Value: true}},
+				"name": primitive.Regex{Pattern: "^bob", Options: "im"},
+			},
+		},
+		{
+			name: "should compile repeated operators on a field into an $and",
+			node: Group{Operator: "$and", Nodes: []Node{
+				Condition{Field: "name", Operator: "$ne", Value: "a"},
+				Condition{Field: "name", Operator: "$ne", Value: "b"},
+			}},
+			want: bson.M{
+				"name": bson.D{{Key: "$ne", Value: "a"}},
+				"$and": bson.A{bson.M{"name": bson.D{{Key: "$ne", Value: "b"}}}},
+			},
+		},
+		{
+			name: "should compile conflicting conditions into an $and",
+			node: Group{Operator: "$and", Nodes: []Node{
+				Group{Operator: "$or", Nodes: []Node{Condition{Field: "a", Operator: "$eq", Value: 1}}},
+				Group{Operator: "$or", Nodes: []Node{Condition{Field: "b", Operator: "$eq", Value: 2}}},
+			}},
+			want: bson.M{
+				"$or":  bson.A{bson.M{"a": 1}},
+				"$and": bson.A{bson.M{"$or": bson.A{bson.M{"b": 2}}}},
+			},
+		},
+		{
+			name: "should compile nested groups and conditions without fields",
+			node: Group{Operator: "$nor", Nodes: []Node{
+				Condition{Operator: "$expr", Value: bson.M{"$gt": bson.A{"$a", "$b"}}},
+			}},
+			want: bson.M{"$nor": bson.A{bson.M{"$expr": bson.M{"$gt": bson.A{"$a", "$b"}}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compile(tt.node); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Compile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryBuilder_AddRewriteRule(t *testing.T) {
+	errRejected := errors.New("rejected")
+
+	tests := []struct {
+		name    string
+		rule    RewriteRule
+		qs      string
+		want    bson.M
+		wantErr bool
+	}{
+		{
+			name: "should rewrite conditions",
+			rule: func(node Node) (Node, error) {
+				if c, ok := node.(Condition); ok && c.Field == "name" {
+					c.Field = "fullName"
+					return c, nil
+				}
+				return node, nil
+			},
+			qs:   "filter[name]=bob",
+			want: bson.M{"fullName": "bob"},
+		},
+		{
+			name: "should remove nodes",
+			rule: func(node Node) (Node, error) {
+				if c, ok := node.(Condition); ok && c.Field == "internalRef" {
+					return nil, nil
+				}
+				return node, nil
+			},
+			qs:   "filter[internalRef]=abc&filter[age]=5",
+			want: bson.M{"age": int32(5)},
+		},
+		{
+			name: "should rewrite conditions within $elemMatch",
+			rule: func(node Node) (Node, error) {
+				if c, ok := node.(Condition); ok && c.Field == "qty" {
+					c.Operator = "$gte"
+					return c, nil
+				}
+				return node, nil
+			},
+			qs:   "filter[items.[*].qty]=3",
+			want: bson.M{"items": bson.D{{Key: "$elemMatch", Value: bson.M{"qty": bson.D{{Key: "$gte", Value: int32(3)}}}}}},
+		},
+		{
+			name: "should return errors from rules",
+			rule: func(node Node) (Node, error) {
+				if c, ok := node.(Condition); ok && c.Operator == "$regex" {
+					return nil, errRejected
+				}
+				return node, nil
+			},
+			qs:      "filter[name]=*bob*",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := (&QueryBuilder{
+				collection: "test",
+				fieldTypes: astFieldTypes,
+			}).AddRewriteRule(tt.rule)
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			got, err := qb.Filter(qo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryBuilder.Filter() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr && !errors.Is(err, errRejected) {
+				t.Errorf("QueryBuilder.Filter() error = %v, want %v", err, errRejected)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryBuilder.Filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -16,16 +16,86 @@ var (
 	reWord = regexp.MustCompile(`\p{L}|[0-9]+`)
 )
 
-func detectDateComparisonOperator(field string, values []string) bson.M {
+func detectBoolComparisonOperator(field string, values []string, aliases map[string]bool) ([]Node, error) {
+	in := bson.A{}
+	nin := bson.A{}
+
+	for _, value := range values {
+		usedNe := false
+		if strings.HasPrefix(value, "-") {
+			usedNe = true
+			value = strings.TrimPrefix(value, "-")
+		}
+
+		// null matches values that are null or missing
+		var bv interface{}
+		if value != "null" {
+			v, ok := parseBool(value, aliases)
+			if !ok {
+				// values that are not booleans are rejected rather than ignored
+				// so that the filter is never broader than was requested
+				return nil, fmt.Errorf("invalid value %s to filter bool field %s", value, field)
+			}
+			bv = v
+		}
+
+		if usedNe {
+			nin = append(nin, bv)
+		} else {
+			in = append(in, bv)
+		}
+	}
+
+	// single values are compared directly
+	if len(in)+len(nin) == 1 {
+		if len(nin) == 1 {
+			return []Node{Condition{Field: field, Operator: "$ne", Value: nin[0]}}, nil
+		}
+
+		return []Node{Condition{Field: field, Operator: "$eq", Value: in[0]}}, nil
+	}
+
+	nodes := []Node{}
+	if len(in) > 0 {
+		nodes = append(nodes, Condition{Field: field, Operator: "$in", Value: in})
+	}
+
+	if len(nin) > 0 {
+		nodes = append(nodes, Condition{Field: field, Operator: "$nin", Value: nin})
+	}
+
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+
+	return nodes, nil
+}
+
+// parseBool parses a boolean value using any configured aliases (i.e. yes/no)
+// before the values accepted by strconv.ParseBool
+func parseBool(value string, aliases map[string]bool) (bool, bool) {
+	if v, ok := aliases[strings.ToLower(value)]; ok {
+		return v, true
+	}
+
+	v, err := strconv.ParseBool(value)
+
+	return v, err == nil
+}
+
+func detectDateComparisonOperator(field string, values []string) ([]Node, error) {
 	if len(values) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	// if values is greater than 0, use an $in/$nin clause
 	if len(values) > 1 {
 		a := bson.A{}
 
-		parsedValues, operator := mustDetectNotInOperator(values)
+		parsedValues, operator, err := detectNotInOperator(field, values)
+		if err != nil {
+			return nil, err
+		}
 
 		// add each string value to the bson.A
 		rangeFilterUsed := false
@@ -37,40 +107,21 @@ func detectDateComparisonOperator(field string, values []string) bson.M {
 
 			dv, err := time.Parse(time.RFC3339, v)
 			if err != nil {
-				panic(err)
+				return nil, fmt.Errorf("invalid value %s to filter date field %s", v, field)
 			}
-			fmt.Println(dv)
 			a = append(a, dv)
 		}
 
 		// return a filter with the array of values...
 		if rangeFilterUsed && len(a) == 2 {
-			return bson.M{
-				field: bson.D{
-					primitive.E{
-						Key:   "$gte",
-						Value: a[0],
-					},
-					primitive.E{
-						Key:   "$lte",
-						Value: a[1],
-					},
-				},
-			}
-		} else {
-			fmt.Println("not range")
+			return []Node{
+				Condition{Field: field, Operator: "$gte", Value: a[0]},
+				Condition{Field: field, Operator: "$lte", Value: a[1]},
+			}, nil
 		}
 
 		// create a filter with the array of values...
-		filter := bson.M{
-			field: bson.D{primitive.E{
-				Key:   operator,
-				Value: a,
-			}},
-		}
-
-		// return
-		return filter
+		return []Node{Condition{Field: field, Operator: operator, Value: a}}, nil
 	}
 
 	value := values[0]
@@ -82,12 +133,6 @@ func detectDateComparisonOperator(field string, values []string) bson.M {
 		value = value[2:]
 	}
 
-	elementMatchOperator := false
-	if len(value) > 2 && value[0:2] == "[]" {
-		elementMatchOperator = true
-		value = value[2:]
-	}
-
 	// check if string value is long enough for a 2 char prefix
 	if len(value) >= 3 {
 		var uv string
@@ -144,18 +189,14 @@ func detectDateComparisonOperator(field string, values []string) bson.M {
 		}
 	}
 
+	// equality unless there is an lt, lte, gt, gte or ne prefix
+	if oper == "" {
+		oper = "$eq"
+	}
+
 	// detect usage of keyword "null"
 	if reNull.MatchString(value) {
-		// check if there is an lt, lte, gt or gte key
-		if oper != "" {
-			return bson.M{field: bson.D{primitive.E{
-				Key:   oper,
-				Value: nil,
-			}}}
-		}
-
-		// return the filter
-		return bson.M{field: nil}
+		return []Node{Condition{Field: field, Operator: oper, Value: nil}}, nil
 	}
 
 	// parse the date value
@@ -167,45 +208,14 @@ func detectDateComparisonOperator(field string, values []string) bson.M {
 
 	// "OR" handling
 	if orOperator {
-		if oper != "" {
-			return bson.M{"$or": bson.M{
-				field: primitive.E{Key: oper, Value: dv},
-			}}
-		}
-		return bson.M{"$or": bson.M{
-			field: dv,
-		}}
-	}
-
-	if elementMatchOperator {
-		// get the parent field name using dot notation
-		split := strings.Split(field, ".")
-		parentField := strings.Join(split[0:len(split)-1], ".")
-		childField := split[len(split)-1]
-
-		return bson.M{
-			parentField: bson.M{
-				"$elemMatch": bson.M{
-					//TODO: this is for Null check, need to handle other cases as well
-					childField: dv,
-				},
-			}}
-	}
-
-	// check if there is an lt, lte, gt or gte key
-	if oper != "" {
-		return bson.M{field: bson.D{primitive.E{
-			Key:   oper,
-			Value: dv,
-		}}}
+		return []Node{either(Condition{Field: field, Operator: oper, Value: dv})}, nil
 	}
 
-	// return the filter
-	return bson.M{field: dv}
+	return []Node{Condition{Field: field, Operator: oper, Value: dv}}, nil
 }
 
-// mustDetectNotInOperator detects $in for all positive VS $nin for all negative values
-func mustDetectNotInOperator(values []string) (updatedValues []string, operator string) {
+// detectNotInOperator detects $in for all positive VS $nin for all negative values
+func detectNotInOperator(field string, values []string) (updatedValues []string, operator string, err error) {
 	operator = "$in"
 
 	notInCnt := 0
@@ -217,13 +227,26 @@ func mustDetectNotInOperator(values []string) (updatedValues []string, operator
 		updatedValues = append(updatedValues, strings.TrimPrefix(value, "-"))
 	}
 	if notInCnt > 0 && notInCnt != len(values) {
-		panic("all elements must me either positive or negative")
+		return nil, "", fmt.Errorf("values to filter field %s must be either all positive or all negative", field)
 	}
 
-	return updatedValues, operator
+	return updatedValues, operator, nil
 }
 
-func detectNumericComparisonOperator(field string, values []string, numericType string) bson.M {
+// trimComparisonPrefix removes the "||" and comparison prefixes (i.e. ">=")
+// from a filter value
+func trimComparisonPrefix(value string) string {
+	value = strings.TrimPrefix(value, "||")
+	for _, prefix := range []string{"><", "{}", "<=", ">=", "!=", "<", ">", "-"} {
+		if strings.HasPrefix(value, prefix) {
+			return strings.TrimPrefix(value, prefix)
+		}
+	}
+
+	return value
+}
+
+func detectNumericComparisonOperator(field string, values []string, numericType string) []Node {
 	if len(values) == 0 {
 		return nil
 	}
@@ -280,38 +303,18 @@ func detectNumericComparisonOperator(field string, values []string, numericType
 
 		// return a filter with the array of values...
 		if rangeFilterUsed && len(a) == 2 {
-			return bson.M{
-				field: bson.D{
-					primitive.E{
-						Key:   "$gte",
-						Value: a[0],
-					},
-					primitive.E{
-						Key:   "$lte",
-						Value: a[1],
-					},
-				},
+			return []Node{
+				Condition{Field: field, Operator: "$gte", Value: a[0]},
+				Condition{Field: field, Operator: "$lte", Value: a[1]},
 			}
 		}
 
 		// return a filter with the array of values...
 		if allFilterUsed {
-			return bson.M{
-				field: bson.D{
-					primitive.E{
-						Key:   "$all",
-						Value: a,
-					},
-				},
-			}
+			return []Node{Condition{Field: field, Operator: "$all", Value: a}}
 		}
 
-		return bson.M{
-			field: bson.D{primitive.E{
-				Key:   "$in",
-				Value: a,
-			}},
-		}
+		return []Node{Condition{Field: field, Operator: "$in", Value: a}}
 	}
 
 	var oper string
@@ -323,12 +326,6 @@ func detectNumericComparisonOperator(field string, values []string, numericType
 		value = value[2:]
 	}
 
-	elementMatchOperator := false
-	if len(value) > 2 && value[0:2] == "[]" {
-		elementMatchOperator = true
-		value = value[2:]
-	}
-
 	// check if string value is long enough for a 2 char prefix
 	if len(value) >= 3 {
 		var uv string
@@ -386,15 +383,11 @@ func detectNumericComparisonOperator(field string, values []string, numericType
 			oper = "$ne"
 		}
 
-		if oper != "" {
-			// return with the specified operator
-			return bson.M{field: bson.D{primitive.E{
-				Key:   oper,
-				Value: nil,
-			}}}
+		if oper == "" {
+			oper = "$eq"
 		}
 
-		return bson.M{field: nil}
+		return []Node{Condition{Field: field, Operator: oper, Value: nil}}
 	}
 
 	// parse the numeric value appropriately
@@ -425,83 +418,86 @@ func detectNumericComparisonOperator(field string, values []string, numericType
 		}
 	}
 
+	// no operator... just the value
+	if oper == "" {
+		oper = "$eq"
+	}
+
 	// "OR" handling
 	if orOperator {
-		if oper != "" {
-			return bson.M{"$or": bson.M{
-				field: primitive.E{
-					Key:   oper,
-					Value: parsedValue,
-				},
-			}}
-		}
-		return bson.M{"$or": bson.M{
-			field: parsedValue,
-		}}
-	}
-
-	if elementMatchOperator {
-		// get the parent field name using dot notation
-		split := strings.Split(field, ".")
-		parentField := strings.Join(split[0:len(split)-1], ".")
-		childField := split[len(split)-1]
-
-		return bson.M{
-			parentField: bson.M{
-				"$elemMatch": bson.M{
-					childField: parsedValue,
-				},
-			},
-		}
-	}
-
-	// check if there is an lt, lte, gt or gte key
-	if oper != "" {
-		// return with the specified operator
-		return bson.M{field: bson.D{primitive.E{
-			Key:   oper,
-			Value: parsedValue,
-		}}}
+		return []Node{either(Condition{Field: field, Operator: oper, Value: parsedValue})}
 	}
 
-	// no operator... just the value
-	return bson.M{field: parsedValue}
+	return []Node{Condition{Field: field, Operator: oper, Value: parsedValue}}
 }
 
-func detectStringComparisonOperator(field string, values []string, bsonType string) bson.M {
+// detectBitwiseOperator builds a clause using one of the bitwise operators
+// (i.e. $bitsAllSet) for int and long fields... a single value is used as a
+// bitmask while multiple values are used as a list of bit positions
+func detectBitwiseOperator(field string, operator string, values []string, numericType string) ([]Node, error) {
+	if numericType != "int" && numericType != "long" {
+		return nil, fmt.Errorf("operator %s requires an int or long field, but field %s is %s", operator, field, numericType)
+	}
+
 	if len(values) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	if strings.Contains(field, ".[*].") {
-		// get the parent field name using dot notation
-		split := strings.Split(field, ".[*].")
-		parentField := split[0]
-		childField := split[1]
+	// bitmask
+	if len(values) == 1 {
+		mask, err := strconv.ParseInt(values[0], 0, 64)
+		if err != nil || mask < 0 {
+			return nil, fmt.Errorf("invalid bitmask %s to filter field %s", values[0], field)
+		}
 
-		inArrayPart := detectDateComparisonOperator(childField, values)[childField].(bson.D)[0]
+		return []Node{Condition{Field: field, Operator: operator, Value: mask}}, nil
+	}
 
-		return bson.M{
-			parentField: bson.M{
-				"$elemMatch": bson.M{
-					"$or": bson.A{
-						bson.M{
-							childField: bson.M{
-								inArrayPart.Key: inArrayPart.Value,
-							},
-						},
-						bson.M{
-							childField: nil, // allow for null values
-						},
-					},
-				},
-			},
+	// bit positions
+	a := bson.A{}
+	for _, value := range values {
+		position, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || position < 0 {
+			return nil, fmt.Errorf("invalid bit position %s to filter field %s", value, field)
 		}
+
+		a = append(a, int32(position))
+	}
+
+	return []Node{Condition{Field: field, Operator: operator, Value: a}}, nil
+}
+
+// detectModuloOperator builds a $mod clause from a divisor and remainder
+func detectModuloOperator(field string, values []string, numericType string) ([]Node, error) {
+	if numericType != "int" && numericType != "long" {
+		return nil, fmt.Errorf("operator $mod requires an int or long field, but field %s is %s", field, numericType)
+	}
+
+	if len(values) != 2 {
+		return nil, fmt.Errorf("a divisor and remainder are required to filter field %s by modulo", field)
+	}
+
+	divisor, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil || divisor == 0 {
+		return nil, fmt.Errorf("invalid divisor %s to filter field %s", values[0], field)
+	}
+
+	remainder, err := strconv.ParseInt(values[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remainder %s to filter field %s", values[1], field)
+	}
+
+	return []Node{Condition{Field: field, Operator: "$mod", Value: bson.A{divisor, remainder}}}, nil
+}
+
+func detectStringComparisonOperator(field string, values []string, bsonType string, collationMatch bool) []Node {
+	if len(values) == 0 {
+		return nil
 	}
 
 	// if bsonType is object, query should use an exists operator
 	if bsonType == "object" {
-		filter := bson.M{}
+		nodes := []Node{}
 
 		for _, fn := range values {
 			// check for "-" prefix on field name
@@ -520,13 +516,10 @@ func detectStringComparisonOperator(field string, values []string, bsonType stri
 			}
 
 			fn = fmt.Sprintf("%s.%s", field, fn)
-			filter[fn] = bson.D{primitive.E{
-				Key:   "$exists",
-				Value: exists,
-			}}
+			nodes = append(nodes, Condition{Field: fn, Operator: "$exists", Value: exists})
 		}
 
-		return filter
+		return nodes
 	}
 
 	// if values is greater than 0, use an $in clause
@@ -546,26 +539,16 @@ func detectStringComparisonOperator(field string, values []string, bsonType stri
 
 		// return a filter with the array of values...
 		if allFilterUsed {
-			return bson.M{
-				field: bson.D{
-					primitive.E{
-						Key:   "$all",
-						Value: a,
-					},
-				},
-			}
+			return []Node{Condition{Field: field, Operator: "$all", Value: a}}
 		}
 
 		// when type is an array, don't use $in operator
 		if bsonType == "array" {
-			return bson.M{field: a}
+			return []Node{Condition{Field: field, Operator: "$eq", Value: a}}
 		}
 
 		// create a filter with the array of values using an $in operator for strings...
-		return bson.M{field: bson.D{primitive.E{
-			Key:   "$in",
-			Value: a,
-		}}}
+		return []Node{Condition{Field: field, Operator: "$in", Value: a}}
 	}
 
 	// single value
@@ -582,18 +565,12 @@ func detectStringComparisonOperator(field string, values []string, bsonType stri
 	ew := false
 	ne := false
 	orOperator := false
-	elementMatchOperator := false
 
 	if len(value) > 2 && value[0:2] == "||" {
 		orOperator = true
 		value = value[2:]
 	}
 
-	if len(value) > 2 && value[0:2] == "[]" {
-		elementMatchOperator = true
-		value = value[2:]
-	}
-
 	// check for prefix/suffix on the value string
 	if len(value) > 1 {
 		bw = value[len(value)-1:] == "*"
@@ -620,36 +597,12 @@ func detectStringComparisonOperator(field string, values []string, bsonType stri
 	if orOperator {
 		//TODO handle other regexp cases as well
 		if containsOperator {
-			return bson.M{"$or": bson.M{
-				field: primitive.Regex{
-					Pattern: value,
-					Options: "im",
-				},
-			}}
-		}
-		return bson.M{"$or": bson.M{
-			field: value,
-		}}
-	}
-
-	if elementMatchOperator {
-		// get the parent field name using dot notation
-		split := strings.Split(field, ".")
-		parentField := strings.Join(split[0:len(split)-1], ".")
-		childField := split[len(split)-1]
-
-		v := &value
-		if value == "nil" {
-			// handle nil keyword
-			v = nil
-		}
-		return bson.M{
-			parentField: bson.M{
-				"$elemMatch": bson.M{
-					childField: v,
-				},
-			},
+			return []Node{either(Condition{Field: field, Operator: "$regex", Value: primitive.Regex{
+				Pattern: value,
+				Options: "im",
+			}})}
 		}
+		return []Node{either(Condition{Field: field, Operator: "$eq", Value: value})}
 	}
 
 	// check for != or string in quotes
@@ -670,89 +623,53 @@ func detectStringComparisonOperator(field string, values []string, bsonType stri
 	// handle null keyword
 	if reNull.MatchString(value) {
 		if ne {
-			return bson.M{field: bson.D{primitive.E{
-				Key:   "$ne",
-				Value: nil,
-			}}}
+			return []Node{Condition{Field: field, Operator: "$ne", Value: nil}}
 		}
 
-		return bson.M{field: nil}
+		return []Node{Condition{Field: field, Operator: "$eq", Value: nil}}
 	}
 
 	// not equal...
 	if ne {
-		return bson.M{field: bson.D{primitive.E{
-			Key:   "$ne",
-			Value: value,
-		}}}
+		return []Node{Condition{Field: field, Operator: "$ne", Value: value}}
 	}
 
 	// contains...
 	if containsOperator {
-		return bson.M{field: primitive.Regex{
+		return []Node{Condition{Field: field, Operator: "$regex", Value: primitive.Regex{
 			Pattern: value,
 			Options: "im",
-		}}
+		}}}
 	}
 
 	// begins with...
 	if bw {
-		return bson.M{field: primitive.Regex{
+		return []Node{Condition{Field: field, Operator: "$regex", Value: primitive.Regex{
 			Pattern: fmt.Sprintf("^%s", value),
 			Options: "im",
-		}}
+		}}}
 	}
 
 	// ends with...
 	if ew {
-		return bson.M{field: primitive.Regex{
+		return []Node{Condition{Field: field, Operator: "$regex", Value: primitive.Regex{
 			Pattern: fmt.Sprintf("%s$", value),
 			Options: "im",
-		}}
+		}}}
+	}
+
+	// exact match (compared using the collation when matching with one)...
+	if em && collationMatch {
+		return []Node{Condition{Field: field, Operator: "$eq", Value: value}}
 	}
 
-	// exact match...
 	if em {
-		return bson.M{field: primitive.Regex{
+		return []Node{Condition{Field: field, Operator: "$regex", Value: primitive.Regex{
 			Pattern: fmt.Sprintf("^%s$", value),
 			Options: "",
-		}}
+		}}}
 	}
 
 	// the string value as is...
-	return bson.M{field: value}
-}
-
-func combine(a bson.M, b bson.M) bson.M {
-	for k, v := range b {
-		if k == "$or" {
-			if a[k] == nil {
-				a[k] = bson.A{}
-			}
-			a[k] = append(a[k].(bson.A), v)
-			continue
-		} else if lvl1Bson, ok := v.(bson.M); ok {
-			// check if the value is an object with a key of "$elemMatch"
-			// if so, we need to append the value to the array
-			added := false
-			for k2, v2 := range lvl1Bson {
-				if k2 == "$elemMatch" {
-					if a == nil || a[k] == nil {
-						a[k] = lvl1Bson
-					} else {
-						a[k] = bson.M{
-							"$elemMatch": combine(a[k].(bson.M)["$elemMatch"].(bson.M), v2.(bson.M)),
-						}
-					}
-					added = true
-				}
-			}
-			if added {
-				continue
-			}
-		}
-		a[k] = v
-	}
-
-	return a
+	return []Node{Condition{Field: field, Operator: "$eq", Value: value}}
 }
@@ -0,0 +1,159 @@
+package querybuilder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// setOperators are the operators whose values are a set, where the order of
+// the values has no meaning
+var setOperators = map[string]bool{
+	"$all": true,
+	"$and": true,
+	"$in":  true,
+	"$nin": true,
+	"$nor": true,
+	"$or":  true,
+}
+
+// FilterD builds a filter in the same manner as Filter, returning the filter
+// in its canonical form (see Canonical) so that the order of the fields and
+// operators is deterministic
+func (qb QueryBuilder) FilterD(qo queryoptions.Options) (bson.D, error) {
+	return qb.FilterDContext(context.Background(), qo)
+}
+
+// FilterDContext builds a filter in the same manner as FilterContext,
+// returning the filter in its canonical form (see Canonical)
+func (qb QueryBuilder) FilterDContext(ctx context.Context, qo queryoptions.Options) (bson.D, error) {
+	filter, err := qb.FilterContext(ctx, qo)
+	if err != nil {
+		return nil, err
+	}
+
+	return Canonical(filter), nil
+}
+
+// Canonical returns the canonical form of a filter: every document is a
+// bson.D with keys in sorted order, and the values of set operators (i.e. $in
+// and $or) are sorted with duplicates removed... equivalent filters produce
+// byte-identical BSON when marshalled
+func Canonical(filter bson.M) bson.D {
+	return canonicalDocument(filter)
+}
+
+func canonicalDocument(m bson.M) bson.D {
+	d := bson.D{}
+	for _, key := range sortedKeys(m) {
+		d = append(d, primitive.E{Key: key, Value: canonicalValue(key, m[key])})
+	}
+
+	return d
+}
+
+func canonicalValue(key string, v interface{}) interface{} {
+	// the operands of aggregation operators are ordered (i.e. $in is
+	// [<expression>, <array>])
+	if key == "$expr" {
+		return canonicalExpr(v)
+	}
+
+	switch v := v.(type) {
+	case bson.M:
+		return canonicalDocument(v)
+	case bson.D:
+		return canonicalDocument(v.Map())
+	case bson.A:
+		a := bson.A{}
+		for _, value := range v {
+			a = append(a, canonicalValue("", value))
+		}
+
+		if setOperators[key] {
+			return sortValues(a)
+		}
+
+		return a
+	}
+
+	return v
+}
+
+// canonicalExpr returns the canonical form of an aggregation expression: every
+// document is a bson.D with keys in sorted order, while the order of arrays is
+// retained
+func canonicalExpr(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bson.M:
+		d := bson.D{}
+		for _, key := range sortedKeys(v) {
+			d = append(d, primitive.E{Key: key, Value: canonicalExpr(v[key])})
+		}
+		return d
+	case bson.D:
+		return canonicalExpr(v.Map())
+	case bson.A:
+		a := bson.A{}
+		for _, value := range v {
+			a = append(a, canonicalExpr(value))
+		}
+		return a
+	}
+
+	return v
+}
+
+// canonicalProjection returns the projection with its fields in sorted order
+func canonicalProjection(projection interface{}) bson.D {
+	switch p := projection.(type) {
+	case map[string]int:
+		m := bson.M{}
+		for k, v := range p {
+			m[k] = v
+		}
+		return canonicalDocument(m)
+	case bson.M:
+		return canonicalDocument(p)
+	}
+
+	return nil
+}
+
+// sortValues sorts values by their BSON encoding, removing any duplicates
+func sortValues(a bson.A) bson.A {
+	type encodedValue struct {
+		encoded []byte
+		value   interface{}
+	}
+
+	values := []encodedValue{}
+	for _, value := range a {
+		encoded, err := bson.Marshal(bson.D{{Key: "v", Value: value}})
+		if err != nil {
+			encoded = []byte(fmt.Sprintf("%v", value))
+		}
+
+		values = append(values, encodedValue{encoded, value})
+	}
+
+	sort.SliceStable(values, func(i, j int) bool {
+		return bytes.Compare(values[i].encoded, values[j].encoded) < 0
+	})
+
+	sorted := bson.A{}
+	for i, v := range values {
+		if i > 0 && bytes.Equal(v.encoded, values[i-1].encoded) {
+			continue
+		}
+
+		sorted = append(sorted, v.value)
+	}
+
+	return sorted
+}
@@ -0,0 +1,138 @@
+package querybuilder
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestQueryBuilder_FilterD(t *testing.T) {
+	qb := QueryBuilder{
+		arrayFields: map[string]bool{"tags": true},
+		collection:  "test",
+		fieldTypes: map[string]string{
+			"age":     "int",
+			"created": "date",
+			"name":    "string",
+			"status":  "string",
+			"tags":    "string",
+		},
+	}
+
+	tests := []struct {
+		name string
+		qs   string
+		want bson.D
+	}{
+		{
+			name: "should order fields and operators",
+			qs:   "filter[status]=active&filter[age]=><18,><65&filter[name]=bob",
+			want: bson.D{
+				{Key: "age", Value: bson.D{{Key: "$gte", Value: int32(18)}, {Key: "$lte", Value: int32(65)}}},
+				{Key: "name", Value: "bob"},
+				{Key: "status", Value: "active"},
+			},
+		},
+		{
+			name: "should sort and remove duplicate values of set operators",
+			qs:   "filter[age]=3,1,2,1",
+			want: bson.D{
+				{Key: "age", Value: bson.D{{Key: "$in", Value: bson.A{int32(1), int32(2), int32(3)}}}},
+			},
+		},
+		{
+			name: "should retain the order of operands of date parts",
+			qs:   "filter[created:dow]=7,6",
+			want: bson.D{
+				{Key: "$expr", Value: bson.D{{Key: "$in", Value: bson.A{
+					bson.D{{Key: "$dayOfWeek", Value: bson.D{{Key: "date", Value: "$created"}, {Key: "timezone", Value: "UTC"}}}},
+					bson.A{int32(7), int32(6)},
+				}}}},
+			},
+		},
+		{
+			name: "should retain the order of operands of sizes",
+			qs:   "filter[tags:size]=2,1",
+			want: bson.D{
+				{Key: "$expr", Value: bson.D{{Key: "$in", Value: bson.A{
+					bson.D{{Key: "$size", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$tags", bson.A{}}}}}},
+					bson.A{int32(2), int32(1)},
+				}}}},
+			},
+		},
+		{
+			name: "should sort $or clauses",
+			qs:   "filter[status]=||b&filter[name]=||a",
+			want: bson.D{
+				{Key: "$or", Value: bson.A{
+					bson.D{{Key: "name", Value: "a"}},
+					bson.D{{Key: "status", Value: "b"}},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			got, err := qb.FilterD(qo)
+			if err != nil {
+				t.Errorf("QueryBuilder.FilterD() error = %v", err)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryBuilder.FilterD() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	a := bson.M{
+		"tags": bson.D{{Key: "$all", Value: bson.A{"b", "a"}}},
+		"location": bson.M{
+			"$nearSphere":  []float64{-73.9, 40.7},
+			"$maxDistance": 1.0,
+		},
+		"age": bson.D{{Key: "$lte", Value: 65}, {Key: "$gte", Value: 18}},
+	}
+	b := bson.M{
+		"age": bson.D{{Key: "$gte", Value: 18}, {Key: "$lte", Value: 65}},
+		"location": bson.M{
+			"$maxDistance": 1.0,
+			"$nearSphere":  []float64{-73.9, 40.7},
+		},
+		"tags": bson.D{{Key: "$all", Value: bson.A{"a", "b", "a"}}},
+	}
+
+	ea, err := bson.Marshal(Canonical(a))
+	if err != nil {
+		t.Errorf("bson.Marshal() error = %v", err)
+		return
+	}
+
+	eb, err := bson.Marshal(Canonical(b))
+	if err != nil {
+		t.Errorf("bson.Marshal() error = %v", err)
+		return
+	}
+
+	if !bytes.Equal(ea, eb) {
+		t.Errorf("Canonical() = %v, want %v", Canonical(a), Canonical(b))
+	}
+
+	// the order of values for operators that are not sets is retained
+	want := bson.D{{Key: "shard", Value: bson.D{{Key: "$mod", Value: bson.A{int64(4), int64(1)}}}}}
+	if got := Canonical(bson.M{"shard": bson.D{primitive.E{Key: "$mod", Value: bson.A{int64(4), int64(1)}}}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Canonical() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package querybuilder
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// datePart describes the aggregation operator and range of values for each
+// date part modifier (i.e. created:dow)
+type datePart struct {
+	operator string
+	min      int32
+	max      int32
+}
+
+var dateParts = map[string]datePart{
+	"dow":   {operator: "$dayOfWeek", min: 1, max: 7},
+	"hour":  {operator: "$hour", min: 0, max: 23},
+	"month": {operator: "$month", min: 1, max: 12},
+}
+
+// SetTimeZone configures the time zone (an Olson time zone identifier such as
+// America/New_York, or a UTC offset such as +05:30) used to extract the day of
+// week, hour and month from date fields... the default is UTC
+func (qb *QueryBuilder) SetTimeZone(timeZone string) *QueryBuilder {
+	qb.timeZone = timeZone
+
+	return qb
+}
+
+// detectDatePartOperator builds an $expr condition comparing a part of the
+// date (i.e. the day of the week) stored in a date or timestamp field
+func (qb QueryBuilder) detectDatePartOperator(name string, field string, modifier string, values []string, bsonType string) ([]Node, error) {
+	if bsonType != "date" && bsonType != "timestamp" {
+		return nil, fmt.Errorf("modifier %s requires a date field, but field %s is %s", modifier, name, bsonType)
+	}
+
+	// values that are not numbers would otherwise be compared as 0
+	for _, value := range values {
+		if _, err := strconv.Atoi(trimComparisonPrefix(value)); err != nil {
+			return nil, fmt.Errorf("invalid %s to filter field %s: %s is not a number", modifier, name, value)
+		}
+	}
+
+	part := dateParts[modifier]
+	nodes := detectNumericComparisonOperator(field, values, "int")
+	if nodes == nil {
+		return nil, nil
+	}
+
+	if err := checkDatePart(nodes, part); err != nil {
+		return nil, fmt.Errorf("invalid %s to filter field %s: %w", modifier, name, err)
+	}
+
+	timeZone := qb.timeZone
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+
+	expr := bson.M{part.operator: bson.M{
+		"date":     fmt.Sprintf("$%s", field),
+		"timezone": timeZone,
+	}}
+
+	return compareExpr(nodes, expr), nil
+}
+
+// checkDatePart verifies the values of a date part filter are within range
+func checkDatePart(v interface{}, part datePart) error {
+	switch v := v.(type) {
+	case int32:
+		if v < part.min || v > part.max {
+			return fmt.Errorf("%d is not between %d and %d", v, part.min, part.max)
+		}
+	case bson.A:
+		for _, value := range v {
+			if err := checkDatePart(value, part); err != nil {
+				return err
+			}
+		}
+	case []Node:
+		for _, n := range v {
+			if err := checkDatePart(n, part); err != nil {
+				return err
+			}
+		}
+	case Condition:
+		return checkDatePart(v.Value, part)
+	case Group:
+		return checkDatePart(v.Nodes, part)
+	}
+
+	return nil
+}
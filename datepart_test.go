@@ -0,0 +1,94 @@
+package querybuilder
+
+import (
+	"reflect"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQueryBuilder_SetTimeZone(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeZone string
+		qs       string
+		want     bson.M
+		wantErr  bool
+	}{
+		{
+			name: "should match days of the week in UTC by default",
+			qs:   "filter[created:dow]=1,7",
+			want: bson.M{"$expr": bson.M{"$in": bson.A{
+				bson.M{"$dayOfWeek": bson.M{"date": "$created", "timezone": "UTC"}},
+				bson.A{int32(1), int32(7)},
+			}}},
+		},
+		{
+			name:     "should match months in the configured time zone",
+			timeZone: "America/New_York",
+			qs:       "filter[created:month]=3",
+			want: bson.M{"$expr": bson.M{"$eq": bson.A{
+				bson.M{"$month": bson.M{"date": "$created", "timezone": "America/New_York"}},
+				int32(3),
+			}}},
+		},
+		{
+			name:     "should compare hours of timestamps",
+			timeZone: "+05:30",
+			qs:       "filter[modified:hour]=>=9",
+			want: bson.M{"$expr": bson.M{"$gte": bson.A{
+				bson.M{"$hour": bson.M{"date": "$modified", "timezone": "+05:30"}},
+				int32(9),
+			}}},
+		},
+		{
+			name:    "should reject values that are out of range",
+			qs:      "filter[created:month]=13",
+			wantErr: true,
+		},
+		{
+			name:    "should reject values that are not numbers",
+			qs:      "filter[created:hour]=foo",
+			wantErr: true,
+		},
+		{
+			name:    "should reject ranges with values that are not numbers",
+			qs:      "filter[created:dow]=><2,><foo",
+			wantErr: true,
+		},
+		{
+			name:    "should reject fields that are not dates",
+			qs:      "filter[name:dow]=1",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := (&QueryBuilder{
+				collection: "test",
+				fieldTypes: map[string]string{
+					"created":  "date",
+					"modified": "timestamp",
+					"name":     "string",
+				},
+			}).SetTimeZone(tt.timeZone)
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			got, err := qb.Filter(qo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryBuilder.Filter() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryBuilder.Filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
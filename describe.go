@@ -0,0 +1,466 @@
+package querybuilder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultMessages are the (English) templates used by Describe... conditions
+// on date fields use the template for the operator with a :date suffix when
+// there is one (i.e. $gt:date)
+var defaultMessages = map[string]string{
+	"$all":       "{{.Field}} includes all of {{.Value}}",
+	"$elemMatch": "{{.Field}} has an item where {{.Value}}",
+	"$eq":        "{{.Field}} is {{.Value}}",
+	"$exists":    `{{.Field}} {{if eq .Value "true"}}exists{{else}}does not exist{{end}}`,
+	"$gt":        "{{.Field}} greater than {{.Value}}",
+	"$gt:date":   "{{.Field}} after {{.Value}}",
+	"$gte":       "{{.Field}} at least {{.Value}}",
+	"$gte:date":  "{{.Field}} on or after {{.Value}}",
+	"$in":        "{{.Field}} is one of {{.Value}}",
+	"$lt":        "{{.Field}} less than {{.Value}}",
+	"$lt:date":   "{{.Field}} before {{.Value}}",
+	"$lte":       "{{.Field}} at most {{.Value}}",
+	"$lte:date":  "{{.Field}} on or before {{.Value}}",
+	"$ne":        "{{.Field}} is not {{.Value}}",
+	"$nin":       "{{.Field}} is not one of {{.Value}}",
+	"$nor":       "not ({{.Value}})",
+	"$regex":     "{{.Field}} matches {{.Value}}",
+	"$size":      "{{.Field}} has {{.Value}} items",
+	"$text":      "matches the keywords {{.Value}}",
+	"all":        "all documents",
+	"and":        "and",
+	"beginsWith": "{{.Field}} begins with {{.Value}}",
+	"contains":   "{{.Field}} contains {{.Value}}",
+	"default":    "{{.Field}} {{.Operator}} {{.Value}}",
+	"endsWith":   "{{.Field}} ends with {{.Value}}",
+	"or":         "or",
+	"page":       "page {{.Number}} ({{.Size}} per page)",
+	"range":      "results {{.From}} to {{.To}}",
+	"skip":       "results from {{.From}}",
+	"sort":       "sorted by {{.Value}}",
+	"sort:desc":  "{{.Field}} descending",
+	"sort:score": "relevance",
+	"then":       "then",
+}
+
+// SetMessages configures the templates (see text/template) used by Describe,
+// i.e. to localise descriptions... templates are keyed by operator (i.e. $gt,
+// or $gt:date for date fields) or by the part of the description (i.e. page
+// and sort) and receive the Field (label), Operator and Value, or the Number,
+// Size, From and To of the page. Keys without a template use the default
+// (English) template.
+func (qb *QueryBuilder) SetMessages(messages map[string]string) *QueryBuilder {
+	qb.messages = map[string]string{}
+	for key, message := range messages {
+		qb.messages[key] = message
+	}
+
+	return qb
+}
+
+// Describe returns a plain language description of the query described by the
+// query options (i.e. "name begins with 'bas' and created after 2021-02-16,
+// sorted by name, page 2 (20 per page)"), labelling fields with the title (or
+// description) of the field in the schema
+func (qb QueryBuilder) Describe(qo queryoptions.Options) (string, error) {
+	return qb.DescribeContext(context.Background(), qo)
+}
+
+// DescribeContext returns a plain language description of the query in the
+// same manner as Describe, applying any field policy configured for the
+// QueryBuilder to the caller identified by the provided context
+func (qb QueryBuilder) DescribeContext(ctx context.Context, qo queryoptions.Options) (string, error) {
+	node, err := qb.rewriteContext(ctx, qo)
+	if err != nil {
+		return "", err
+	}
+
+	opts, err := qb.FindOptionsContext(ctx, qo)
+	if err != nil {
+		return "", err
+	}
+
+	filter, err := qb.describeNode("", node, false)
+	if err != nil {
+		return "", err
+	}
+
+	if filter == "" {
+		if filter, err = qb.message("all", nil); err != nil {
+			return "", err
+		}
+	}
+
+	parts := []string{filter}
+
+	sort, err := qb.describeSort(opts.Sort)
+	if err != nil {
+		return "", err
+	}
+
+	page, err := qb.describePage(opts)
+	if err != nil {
+		return "", err
+	}
+
+	for _, part := range []string{sort, page} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, ", "), nil
+}
+
+// describeNode describes a node of the AST... the fields of the conditions
+// within an $elemMatch are relative to the array field (the prefix)
+func (qb QueryBuilder) describeNode(prefix string, node Node, nested bool) (string, error) {
+	switch n := node.(type) {
+	case Group:
+		descriptions := []string{}
+		for _, child := range n.Nodes {
+			description, err := qb.describeNode(prefix, child, len(n.Nodes) > 1)
+			if err != nil {
+				return "", err
+			}
+
+			if description != "" {
+				descriptions = append(descriptions, description)
+			}
+		}
+
+		if len(descriptions) == 0 {
+			return "", nil
+		}
+
+		if n.Operator == "$and" {
+			return qb.join("and", descriptions)
+		}
+
+		description, err := qb.join("or", descriptions)
+		if err != nil {
+			return "", err
+		}
+
+		if n.Operator == "$nor" {
+			return qb.message("$nor", map[string]interface{}{"Value": description})
+		}
+
+		if nested && len(descriptions) > 1 {
+			description = fmt.Sprintf("(%s)", description)
+		}
+
+		return description, nil
+	case Condition:
+		return qb.describeCondition(prefix, n)
+	}
+
+	return "", nil
+}
+
+func (qb QueryBuilder) describeCondition(prefix string, c Condition) (string, error) {
+	path := c.Field
+	if prefix != "" {
+		path = fmt.Sprintf("%s.%s", prefix, c.Field)
+	}
+
+	data := map[string]interface{}{
+		"Field":    qb.fieldLabel(path),
+		"Operator": c.Operator,
+	}
+
+	switch c.Operator {
+	case "$elemMatch":
+		if inner, ok := c.Value.(Node); ok {
+			description, err := qb.describeNode(path, inner, false)
+			if err != nil {
+				return "", err
+			}
+
+			data["Value"] = description
+
+			return qb.message(c.Operator, data)
+		}
+	case "$expr":
+		return qb.describeExpr(c.Value)
+	case "$regex":
+		if re, ok := c.Value.(primitive.Regex); ok {
+			return qb.describeRegex(data, re)
+		}
+	case "$text":
+		if text, ok := c.Value.(bson.D); ok {
+			data["Value"] = qb.describeValue(text.Map()["$search"])
+
+			return qb.message(c.Operator, data)
+		}
+	}
+
+	data["Value"] = qb.describeValue(c.Value)
+
+	return qb.message(qb.operatorKey(c.Operator, path), data)
+}
+
+// describeExpr describes comparisons between fields
+func (qb QueryBuilder) describeExpr(expr interface{}) (string, error) {
+	m, ok := expr.(bson.M)
+	if !ok || len(m) != 1 {
+		return qb.message("default", map[string]interface{}{"Field": "", "Operator": "$expr", "Value": renderShell(expr)})
+	}
+
+	for operator, value := range m {
+		a, ok := value.(bson.A)
+		if !ok {
+			break
+		}
+
+		if operator == "$and" {
+			descriptions := []string{}
+			for _, v := range a {
+				description, err := qb.describeExpr(v)
+				if err != nil {
+					return "", err
+				}
+				descriptions = append(descriptions, description)
+			}
+
+			return qb.join("and", descriptions)
+		}
+
+		// comparison of a field with another ($not[$in] is not described)
+		if len(a) != 2 {
+			break
+		}
+
+		field, fok := a[0].(string)
+		other, ook := a[1].(string)
+		if !fok || !ook {
+			break
+		}
+
+		field = strings.TrimPrefix(field, "$")
+		other = strings.TrimPrefix(other, "$")
+
+		return qb.message(qb.operatorKey(operator, field), map[string]interface{}{
+			"Field":    qb.fieldLabel(field),
+			"Operator": operator,
+			"Value":    qb.fieldLabel(other),
+		})
+	}
+
+	return qb.message("default", map[string]interface{}{"Field": "", "Operator": "$expr", "Value": renderShell(expr)})
+}
+
+// describeRegex describes the regular expressions built for begins with, ends
+// with and contains filters
+func (qb QueryBuilder) describeRegex(data map[string]interface{}, re primitive.Regex) (string, error) {
+	pattern := re.Pattern
+	bw := strings.HasPrefix(pattern, "^")
+	ew := strings.HasSuffix(pattern, "$")
+	data["Value"] = qb.describeValue(strings.TrimSuffix(strings.TrimPrefix(pattern, "^"), "$"))
+
+	switch {
+	case bw && ew:
+		return qb.message("$eq", data)
+	case bw:
+		return qb.message("beginsWith", data)
+	case ew:
+		return qb.message("endsWith", data)
+	}
+
+	return qb.message("contains", data)
+}
+
+// describeSort describes the sort built for the options
+func (qb QueryBuilder) describeSort(sort interface{}) (string, error) {
+	keys, ok := sort.(bson.D)
+	if !ok || len(keys) == 0 {
+		return "", nil
+	}
+
+	descriptions := []string{}
+	for _, e := range keys {
+		key := ""
+		switch direction := e.Value.(type) {
+		case int:
+			if direction < 0 {
+				key = "sort:desc"
+			}
+		default:
+			key = "sort:score"
+		}
+
+		description := qb.fieldLabel(e.Key)
+		if key != "" {
+			var err error
+			if description, err = qb.message(key, map[string]interface{}{"Field": description}); err != nil {
+				return "", err
+			}
+		}
+
+		descriptions = append(descriptions, description)
+	}
+
+	description, err := qb.join("then", descriptions)
+	if err != nil {
+		return "", err
+	}
+
+	return qb.message("sort", map[string]interface{}{"Value": description})
+}
+
+// describePage describes the pagination built for the options, as a page when
+// the results skipped are a multiple of the limit
+func (qb QueryBuilder) describePage(opts *options.FindOptions) (string, error) {
+	var skip int64
+	if opts.Skip != nil {
+		skip = *opts.Skip
+	}
+
+	if opts.Limit == nil || *opts.Limit <= 0 {
+		if skip == 0 {
+			return "", nil
+		}
+
+		return qb.message("skip", map[string]interface{}{"From": skip + 1})
+	}
+
+	limit := *opts.Limit
+	data := map[string]interface{}{
+		"From":   skip + 1,
+		"Number": skip/limit + 1,
+		"Size":   limit,
+		"To":     skip + limit,
+	}
+
+	if skip%limit == 0 {
+		return qb.message("page", data)
+	}
+
+	return qb.message("range", data)
+}
+
+// describeValue describes a value, quoting strings and formatting dates
+func (qb QueryBuilder) describeValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("'%s'", v)
+	case *time.Time:
+		if v == nil {
+			return "null"
+		}
+		return qb.describeValue(*v)
+	case time.Time:
+		v = v.UTC()
+		if v.Equal(v.Truncate(24 * time.Hour)) {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	case primitive.DateTime:
+		return qb.describeValue(v.Time())
+	case primitive.Decimal128:
+		return v.String()
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.Regex:
+		return fmt.Sprintf("/%s/", v.Pattern)
+	case bson.A:
+		values := []string{}
+		for _, value := range v {
+			values = append(values, qb.describeValue(value))
+		}
+		return strings.Join(values, ", ")
+	case bool, int, int32, int64, float32, float64:
+		return fmt.Sprintf("%v", v)
+	}
+
+	// other slices (i.e. coordinates)
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice {
+		a := bson.A{}
+		for i := 0; i < rv.Len(); i++ {
+			a = append(a, rv.Index(i).Interface())
+		}
+		return qb.describeValue(a)
+	}
+
+	return renderShell(v)
+}
+
+// fieldLabel returns the label for a stored field: the title (or description)
+// from the schema, otherwise the public name of the field
+func (qb QueryBuilder) fieldLabel(field string) string {
+	if label, ok := qb.fieldLabels[field]; ok {
+		return label
+	}
+
+	return qb.publicField(field)
+}
+
+// operatorKey returns the message key for an operator, using the :date variant
+// for date fields when there is one
+func (qb QueryBuilder) operatorKey(operator string, field string) string {
+	if bsonType := qb.fieldTypes[field]; bsonType == "date" || bsonType == "timestamp" {
+		key := fmt.Sprintf("%s:date", operator)
+		if _, ok := qb.messages[key]; ok {
+			return key
+		}
+
+		if _, ok := defaultMessages[key]; ok {
+			return key
+		}
+	}
+
+	if _, ok := qb.messages[operator]; ok {
+		return operator
+	}
+
+	if _, ok := defaultMessages[operator]; ok {
+		return operator
+	}
+
+	return "default"
+}
+
+// join joins descriptions with a conjunction (i.e. and)
+func (qb QueryBuilder) join(key string, descriptions []string) (string, error) {
+	conjunction, err := qb.message(key, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(descriptions, fmt.Sprintf(" %s ", conjunction)), nil
+}
+
+// message executes the template configured for the key (or the default
+// template when none is configured)
+func (qb QueryBuilder) message(key string, data map[string]interface{}) (string, error) {
+	text, ok := qb.messages[key]
+	if !ok {
+		text = defaultMessages[key]
+	}
+
+	tmpl, err := template.New(key).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid message template for %s: %s", key, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("invalid message template for %s: %s", key, err)
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
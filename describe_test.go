@@ -0,0 +1,117 @@
+package querybuilder
+
+import (
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQueryBuilder_Describe(t *testing.T) {
+	schema := bson.M{
+		"$jsonSchema": bson.M{
+			"bsonType": "object",
+			"properties": bson.M{
+				"age":     bson.M{"bsonType": "int", "title": "Age"},
+				"created": bson.M{"bsonType": "date", "description": "created"},
+				"name":    bson.M{"bsonType": "string"},
+				"status":  bson.M{"bsonType": "string", "title": "Status"},
+				"items": bson.M{
+					"bsonType": "array",
+					"items": bson.M{
+						"bsonType": "object",
+						"properties": bson.M{
+							"qty": bson.M{"bsonType": "int", "title": "Quantity"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		qs       string
+		messages map[string]string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name: "should describe all documents",
+			qs:   "",
+			want: "all documents",
+		},
+		{
+			name: "should describe filter, sort and page",
+			qs:   "filter[name]=bas*&filter[created]=>2021-02-16T00:00:00Z&sort=name&page[offset]=20&page[limit]=20",
+			want: "created after 2021-02-16 and name begins with 'bas', sorted by name, page 2 (20 per page)",
+		},
+		{
+			name: "should label fields using the schema",
+			qs:   "filter[age]=>=18&filter[status]=active,pending&sort=-age,name",
+			want: "Age at least 18 and Status is one of 'active', 'pending', sorted by Age descending then name",
+		},
+		{
+			name: "should describe alternatives",
+			qs:   "filter[status]=||active&filter[name]=||*bob*",
+			want: "name contains 'bob' or Status is 'active'",
+		},
+		{
+			name: "should group alternatives with other conditions",
+			qs:   "filter[age]=<18&filter[status]=||active&filter[name]=||bob",
+			want: "Age less than 18 and (name is 'bob' or Status is 'active')",
+		},
+		{
+			name: "should describe conditions on items of arrays",
+			qs:   "filter[items.[*].qty]=>5",
+			want: "items has an item where Quantity greater than 5",
+		},
+		{
+			name: "should describe results that are not a page",
+			qs:   "page[offset]=5&page[limit]=10",
+			want: "all documents, results 6 to 15",
+		},
+		{
+			name: "should localise using messages",
+			qs:   "filter[created]=<2021-02-16T00:00:00Z&filter[name]=bob&sort=-name",
+			messages: map[string]string{
+				"$eq":       "{{.Field}} est {{.Value}}",
+				"$lt:date":  "{{.Field}} avant {{.Value}}",
+				"and":       "et",
+				"sort":      "trié par {{.Value}}",
+				"sort:desc": "{{.Field}} décroissant",
+			},
+			want: "created avant 2021-02-16 et name est 'bob', trié par name décroissant",
+		},
+		{
+			name:     "should return an error for invalid messages",
+			qs:       "filter[name]=bob",
+			messages: map[string]string{"$eq": "{{.Field"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := NewQueryBuilder("test", schema)
+			if tt.messages != nil {
+				qb.SetMessages(tt.messages)
+			}
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			got, err := qb.Describe(qo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryBuilder.Describe() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("QueryBuilder.Describe() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package querybuilder
+
+import (
+	"fmt"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// reFieldReference matches values that compare a field with another field
+// (i.e. >$startDate)
+var reFieldReference = regexp.MustCompile(`^(<=|>=|!=|<|>|-)?\$([A-Za-z_][A-Za-z0-9_.]*)$`)
+
+// comparableTypes groups the bson types of fields that can be compared...
+// within $expr, values of different bson types are compared by type order
+// rather than value, so dates and timestamps are separate groups
+var comparableTypes = map[string]string{
+	"bool":      "bool",
+	"date":      "date",
+	"decimal":   "number",
+	"double":    "number",
+	"int":       "number",
+	"long":      "number",
+	"objectId":  "objectId",
+	"string":    "string",
+	"timestamp": "timestamp",
+}
+
+// exprOperators maps the prefix of a field reference to an $expr operator
+var exprOperators = map[string]string{
+	"":   "$eq",
+	"<":  "$lt",
+	"<=": "$lte",
+	">":  "$gt",
+	">=": "$gte",
+	"!=": "$ne",
+	"-":  "$ne",
+}
+
+// fieldReference determines whether the values of a filter compare the field
+// with another field, returning the operator prefix and the public name of the
+// other field when they do... values that do not name a field in the schema
+// (i.e. $USD) are always treated as values
+func (qb QueryBuilder) fieldReference(values []string) (string, string, bool) {
+	if len(values) != 1 {
+		return "", "", false
+	}
+
+	m := reFieldReference.FindStringSubmatch(values[0])
+	if m == nil {
+		return "", "", false
+	}
+
+	if _, ok := qb.fieldTypes[qb.storedField(m[2])]; !ok {
+		return "", "", false
+	}
+
+	return m[1], m[2], true
+}
+
+// detectFieldComparison builds an $expr condition comparing the field with the
+// other field, provided both fields exist and have comparable types
+func (qb QueryBuilder) detectFieldComparison(name string, field string, bsonType string, prefix string, other string) ([]Node, error) {
+	stored := qb.storedField(other)
+	otherType, err := qb.lookupField(other, stored)
+	if err != nil {
+		return nil, err
+	}
+
+	if comparableTypes[bsonType] == "" || comparableTypes[bsonType] != comparableTypes[otherType] {
+		return nil, fmt.Errorf("field %s cannot be compared with field %s", name, other)
+	}
+
+	return []Node{Condition{Operator: "$expr", Value: bson.M{
+		exprOperators[prefix]: bson.A{fmt.Sprintf("$%s", field), fmt.Sprintf("$%s", stored)},
+	}}}, nil
+}
+
+// compareExpr converts the conditions built for a field into an $expr
+// comparing the result of an aggregation expression (i.e. the size of an
+// array) instead... legacy || alternatives remain alternatives
+func compareExpr(nodes []Node, expr interface{}) []Node {
+	converted := []Node{}
+	exprs := bson.A{}
+
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case Condition:
+			// aggregation expressions have no $nin operator
+			if n.Operator == "$nin" {
+				exprs = append(exprs, bson.M{"$not": bson.A{bson.M{"$in": bson.A{expr, n.Value}}}})
+				continue
+			}
+
+			exprs = append(exprs, bson.M{n.Operator: bson.A{expr, n.Value}})
+		case Group:
+			n.Nodes = compareExpr(n.Nodes, expr)
+			converted = append(converted, n)
+		}
+	}
+
+	switch len(exprs) {
+	case 0:
+		return converted
+	case 1:
+		return append([]Node{Condition{Operator: "$expr", Value: exprs[0]}}, converted...)
+	}
+
+	return append([]Node{Condition{Operator: "$expr", Value: bson.M{"$and": exprs}}}, converted...)
+}
@@ -0,0 +1,118 @@
+package querybuilder
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQueryBuilder_detectFieldComparison(t *testing.T) {
+	tests := []struct {
+		name             string
+		strictValidation bool
+		qs               string
+		want             bson.M
+		wantErr          bool
+	}{
+		{
+			name: "should compare dates using $expr",
+			qs:   "filter[endDate]=>$startDate",
+			want: bson.M{"$expr": bson.M{"$gt": bson.A{"$endDate", "$startDate"}}},
+		},
+		{
+			name: "should compare numbers of different types",
+			qs:   "filter[stock]=<=$reorderLevel",
+			want: bson.M{"$expr": bson.M{"$lte": bson.A{"$stock", "$inventory.reorder"}}},
+		},
+		{
+			name: "should compare equality",
+			qs:   "filter[name]=$nickname",
+			want: bson.M{"$expr": bson.M{"$eq": bson.A{"$name", "$nickname"}}},
+		},
+		{
+			name: "should require all expressions to be true",
+			qs:   "filter[endDate]=>$startDate&filter[stock]=!=$reorderLevel",
+			want: bson.M{"$expr": bson.M{"$and": bson.A{
+				bson.M{"$gt": bson.A{"$endDate", "$startDate"}},
+				bson.M{"$ne": bson.A{"$stock", "$inventory.reorder"}},
+			}}},
+		},
+		{
+			name: "should treat references to unknown fields as values",
+			qs:   "filter[name]=$unknown",
+			want: bson.M{"name": "$unknown"},
+		},
+		{
+			name:             "should treat references to unknown fields as values with strict validation",
+			strictValidation: true,
+			qs:               "filter[currency]=$USD",
+			want:             bson.M{"currency": "$USD"},
+		},
+		{
+			name:    "should reject comparisons of dates and timestamps",
+			qs:      "filter[endDate]=>$modified",
+			wantErr: true,
+		},
+		{
+			name:    "should reject comparisons of incompatible types",
+			qs:      "filter[stock]=>$startDate",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := (&QueryBuilder{
+				collection: "test",
+				fieldTypes: map[string]string{
+					"currency":          "string",
+					"endDate":           "date",
+					"inventory.reorder": "long",
+					"name":              "string",
+					"nickname":          "string",
+					"modified":          "timestamp",
+					"startDate":         "date",
+					"stock":             "int",
+				},
+				strictValidation: tt.strictValidation,
+			}).SetFieldAliases(map[string]string{"reorderLevel": "inventory.reorder"})
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			got, err := qb.Filter(qo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryBuilder.Filter() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryBuilder.Filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("should strip comparisons with hidden fields", func(t *testing.T) {
+		qb := (&QueryBuilder{
+			collection: "test",
+			fieldTypes: map[string]string{"salary": "int", "bonus": "int"},
+		}).SetFieldPolicy(func(ctx context.Context) FieldAccess {
+			return FieldAccess{HiddenFields: []string{"salary"}}
+		})
+
+		got, err := qb.Filter(queryoptions.Options{Filter: map[string][]string{"bonus": {">$salary"}}})
+		if err != nil {
+			t.Errorf("QueryBuilder.Filter() error = %v", err)
+			return
+		}
+
+		if want := (bson.M{}); !reflect.DeepEqual(got, want) {
+			t.Errorf("QueryBuilder.Filter() = %v, want %v", got, want)
+		}
+	})
+}
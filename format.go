@@ -0,0 +1,274 @@
+package querybuilder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// reIdentifier matches keys and collection names that do not require quotes
+// when rendered in mongosh syntax
+var reIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// Logger is the interface used to log the filters and options built by the
+// QueryBuilder for debugging (i.e. a *log.Logger)
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// SetLogger configures a Logger that the filters and options built by the
+// QueryBuilder are logged to (in mongosh syntax) for debugging
+func (qb *QueryBuilder) SetLogger(logger Logger) *QueryBuilder {
+	qb.logger = logger
+
+	return qb
+}
+
+// Shell renders the query described by the query options (the filter,
+// projection, sort, pagination and collation) as a mongosh command that can be
+// copied and pasted, i.e. db.things.find({ name: "bob" }).sort({ _id: 1 })
+func (qb QueryBuilder) Shell(qo queryoptions.Options) (string, error) {
+	return qb.ShellContext(context.Background(), qo)
+}
+
+// ShellContext renders the query as a mongosh command in the same manner as
+// Shell, applying any field policy configured for the QueryBuilder to the
+// caller identified by the provided context
+func (qb QueryBuilder) ShellContext(ctx context.Context, qo queryoptions.Options) (string, error) {
+	filter, err := qb.FilterContext(ctx, qo)
+	if err != nil {
+		return "", err
+	}
+
+	opts, err := qb.FindOptionsContext(ctx, qo)
+	if err != nil {
+		return "", err
+	}
+
+	collection := fmt.Sprintf("db.%s", qb.collection)
+	if !reIdentifier.MatchString(qb.collection) {
+		collection = fmt.Sprintf("db.getCollection(%s)", strconv.Quote(qb.collection))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s.find(%s", collection, renderShell(filter)))
+	if projection := canonicalProjection(opts.Projection); len(projection) > 0 {
+		sb.WriteString(fmt.Sprintf(", %s", renderShell(projection)))
+	}
+	sb.WriteString(")")
+	sb.WriteString(renderFindOptions(opts))
+
+	return sb.String(), nil
+}
+
+// ExtendedJSON renders the query described by the query options as a
+// document (with filter, sort, projection, skip, limit and collation fields)
+// in MongoDB Extended JSON, using the canonical format when canonical is true
+// and the relaxed format otherwise
+func (qb QueryBuilder) ExtendedJSON(qo queryoptions.Options, canonical bool) (string, error) {
+	return qb.ExtendedJSONContext(context.Background(), qo, canonical)
+}
+
+// ExtendedJSONContext renders the query in Extended JSON in the same manner as
+// ExtendedJSON, applying any field policy configured for the QueryBuilder to
+// the caller identified by the provided context
+func (qb QueryBuilder) ExtendedJSONContext(ctx context.Context, qo queryoptions.Options, canonical bool) (string, error) {
+	filter, err := qb.FilterContext(ctx, qo)
+	if err != nil {
+		return "", err
+	}
+
+	opts, err := qb.FindOptionsContext(ctx, qo)
+	if err != nil {
+		return "", err
+	}
+
+	doc := bson.D{{Key: "filter", Value: displayValue(filter)}}
+	if opts.Sort != nil {
+		doc = append(doc, primitive.E{Key: "sort", Value: opts.Sort})
+	}
+
+	if projection := canonicalProjection(opts.Projection); len(projection) > 0 {
+		doc = append(doc, primitive.E{Key: "projection", Value: projection})
+	}
+
+	if opts.Skip != nil {
+		doc = append(doc, primitive.E{Key: "skip", Value: *opts.Skip})
+	}
+
+	if opts.Limit != nil {
+		doc = append(doc, primitive.E{Key: "limit", Value: *opts.Limit})
+	}
+
+	if opts.Collation != nil {
+		doc = append(doc, primitive.E{Key: "collation", Value: collationDocument(opts.Collation)})
+	}
+
+	b, err := bson.MarshalExtJSON(doc, canonical, false)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// logf logs to the Logger configured for the QueryBuilder (if any)
+func (qb QueryBuilder) logf(format string, v ...interface{}) {
+	if qb.logger != nil {
+		qb.logger.Printf(format, v...)
+	}
+}
+
+// renderFindOptions renders the sort, pagination and collation of the options
+// as mongosh cursor methods
+func renderFindOptions(opts *options.FindOptions) string {
+	var sb strings.Builder
+
+	if opts.Sort != nil {
+		sb.WriteString(fmt.Sprintf(".sort(%s)", renderShell(opts.Sort)))
+	}
+
+	if opts.Skip != nil {
+		sb.WriteString(fmt.Sprintf(".skip(%d)", *opts.Skip))
+	}
+
+	if opts.Limit != nil {
+		sb.WriteString(fmt.Sprintf(".limit(%d)", *opts.Limit))
+	}
+
+	if opts.Collation != nil {
+		sb.WriteString(fmt.Sprintf(".collation(%s)", renderShell(collationDocument(opts.Collation))))
+	}
+
+	return sb.String()
+}
+
+// collationDocument returns the fields of the collation that are set, as sent
+// to the server by the Mongo driver
+func collationDocument(collation *options.Collation) bson.D {
+	d := bson.D{}
+	if err := bson.Unmarshal(collation.ToDocument(), &d); err != nil {
+		return bson.D{}
+	}
+
+	return d
+}
+
+// displayValue returns the value with the keys of its documents in sorted
+// order so that it renders deterministically... unlike Canonical, the values
+// of arrays (i.e. $in) are rendered as built
+func displayValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bson.M:
+		d := bson.D{}
+		for _, key := range sortedKeys(v) {
+			d = append(d, primitive.E{Key: key, Value: displayValue(v[key])})
+		}
+		return d
+	case bson.D:
+		d := bson.D{}
+		for _, e := range v {
+			d = append(d, primitive.E{Key: e.Key, Value: displayValue(e.Value)})
+		}
+		return d
+	case bson.A:
+		a := bson.A{}
+		for _, value := range v {
+			a = append(a, displayValue(value))
+		}
+		return a
+	}
+
+	return v
+}
+
+// renderShell renders a value in mongosh syntax
+func renderShell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bson.D:
+		if len(v) == 0 {
+			return "{}"
+		}
+
+		fields := []string{}
+		for _, e := range v {
+			key := e.Key
+			if !reIdentifier.MatchString(key) {
+				key = strconv.Quote(key)
+			}
+			fields = append(fields, fmt.Sprintf("%s: %s", key, renderShell(e.Value)))
+		}
+
+		return fmt.Sprintf("{ %s }", strings.Join(fields, ", "))
+	case bson.M:
+		return renderShell(displayValue(v))
+	case map[string]int:
+		return renderShell(canonicalProjection(v))
+	case bson.A:
+		items := []string{}
+		for _, value := range v {
+			items = append(items, renderShell(value))
+		}
+
+		return fmt.Sprintf("[%s]", strings.Join(items, ", "))
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return fmt.Sprintf("NumberLong(%d)", v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case primitive.Decimal128:
+		return fmt.Sprintf("NumberDecimal(%s)", strconv.Quote(v.String()))
+	case time.Time:
+		return fmt.Sprintf("ISODate(%s)", strconv.Quote(v.UTC().Format(time.RFC3339Nano)))
+	case *time.Time:
+		if v == nil {
+			return "null"
+		}
+		return renderShell(*v)
+	case primitive.DateTime:
+		return renderShell(v.Time())
+	case primitive.ObjectID:
+		return fmt.Sprintf("ObjectId(%s)", strconv.Quote(v.Hex()))
+	case primitive.Regex:
+		return fmt.Sprintf("/%s/%s", strings.ReplaceAll(v.Pattern, "/", `\/`), v.Options)
+	}
+
+	// other slices (i.e. coordinates)
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice {
+		a := bson.A{}
+		for i := 0; i < rv.Len(); i++ {
+			a = append(a, rv.Index(i).Interface())
+		}
+
+		return renderShell(a)
+	}
+
+	// fallback to relaxed Extended JSON for any other values
+	b, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: v}}, false, false)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(string(b), `{"v":`), "}")
+}
@@ -0,0 +1,220 @@
+package querybuilder
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestQueryBuilder_Shell(t *testing.T) {
+	fieldTypes := map[string]string{
+		"age":     "int",
+		"count":   "long",
+		"created": "date",
+		"name":    "string",
+		"tags":    "string",
+	}
+
+	tests := []struct {
+		name       string
+		collection string
+		qs         string
+		want       string
+	}{
+		{
+			name:       "should render an empty filter",
+			collection: "things",
+			qs:         "",
+			want:       "db.things.find({})",
+		},
+		{
+			name:       "should render filter, projection, sort and pagination",
+			collection: "things",
+			qs:         "filter[name]=bob&filter[age]=>18&fields=name,age&sort=-age&page[offset]=10&page[limit]=5",
+			want:       `db.things.find({ age: { $gt: 18 }, name: "bob" }, { age: 1, name: 1 }).sort({ age: -1 }).skip(10).limit(5)`,
+		},
+		{
+			name:       "should render typed values",
+			collection: "things",
+			qs:         "filter[count]=5&filter[created]=>2021-01-01T00:00:00Z&filter[tags]=a/b*",
+			want:       `db.things.find({ count: NumberLong(5), created: { $gt: ISODate("2021-01-01T00:00:00Z") }, tags: /^a\/b/im })`,
+		},
+		{
+			name:       "should render values in the order they are filtered",
+			collection: "things",
+			qs:         "filter[name]=bob,alice&sort=name,-age",
+			want:       `db.things.find({ name: { $in: ["bob", "alice"] } }).sort({ name: 1, age: -1 })`,
+		},
+		{
+			name:       "should quote collection names that are not identifiers",
+			collection: "my-things",
+			qs:         "filter[name]=bob",
+			want:       `db.getCollection("my-things").find({ name: "bob" })`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := QueryBuilder{collection: tt.collection, fieldTypes: fieldTypes}
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			got, err := qb.Shell(qo)
+			if err != nil {
+				t.Errorf("QueryBuilder.Shell() error = %v", err)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("QueryBuilder.Shell() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryBuilder_ExtendedJSON(t *testing.T) {
+	qb := QueryBuilder{
+		collection: "things",
+		fieldTypes: map[string]string{
+			"age":  "int",
+			"name": "string",
+		},
+	}
+
+	tests := []struct {
+		name      string
+		qs        string
+		canonical bool
+		want      string
+	}{
+		{
+			name: "should render relaxed Extended JSON",
+			qs:   "filter[name]=bob&filter[age]=>18&sort=name&page[limit]=5",
+			want: `{"filter":{"age":{"$gt":18},"name":"bob"},"sort":{"name":1},"limit":5}`,
+		},
+		{
+			name:      "should render canonical Extended JSON",
+			qs:        "filter[age]=>18&page[limit]=5",
+			canonical: true,
+			want:      `{"filter":{"age":{"$gt":{"$numberInt":"18"}}},"limit":{"$numberLong":"5"}}`,
+		},
+		{
+			name: "should render the sort and values in the order they are built",
+			qs:   "filter[name]=bob,alice&sort=name,-age",
+			want: `{"filter":{"name":{"$in":["bob","alice"]}},"sort":{"name":1,"age":-1}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			got, err := qb.ExtendedJSON(qo, tt.canonical)
+			if err != nil {
+				t.Errorf("QueryBuilder.ExtendedJSON() error = %v", err)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("QueryBuilder.ExtendedJSON() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryBuilder_Shell_collation(t *testing.T) {
+	qb := (&QueryBuilder{
+		collection: "things",
+		fieldTypes: map[string]string{"name": "string"},
+	}).SetCollation(&options.Collation{Locale: "fr"}).SetInsensitiveMatching(2)
+
+	qo, err := queryoptions.FromQuerystring("filter[name]=jose")
+	if err != nil {
+		t.Errorf("options.FromQuerystring() error = %v", err)
+		return
+	}
+
+	want := `db.things.find({ name: "jose" }).collation({ locale: "fr", strength: 2 })`
+	if got, err := qb.Shell(qo); err != nil || got != want {
+		t.Errorf("QueryBuilder.Shell() = %v, %v, want %v", got, err, want)
+	}
+
+	want = `{"filter":{"name":"jose"},"collation":{"locale":"fr","strength":2}}`
+	if got, err := qb.ExtendedJSON(qo, false); err != nil || got != want {
+		t.Errorf("QueryBuilder.ExtendedJSON() = %v, %v, want %v", got, err, want)
+	}
+}
+
+func TestQueryBuilder_SetLogger(t *testing.T) {
+	logger := &testLogger{}
+	qb := (&QueryBuilder{
+		collection: "things",
+		fieldTypes: map[string]string{"name": "string"},
+	}).SetLogger(logger)
+
+	qo := queryoptions.Options{
+		Filter: map[string][]string{"name": {"bob"}},
+		Page:   map[string]int{"limit": 5},
+	}
+
+	if _, err := qb.Filter(qo); err != nil {
+		t.Errorf("QueryBuilder.Filter() error = %v", err)
+		return
+	}
+
+	if _, err := qb.FindOptions(qo); err != nil {
+		t.Errorf("QueryBuilder.FindOptions() error = %v", err)
+		return
+	}
+
+	want := []string{
+		`querybuilder: things filter { name: "bob" }`,
+		`querybuilder: things options .limit(5)`,
+	}
+	if got := strings.Join(logger.lines, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("QueryBuilder.SetLogger() logged %v, want %v", logger.lines, want)
+	}
+}
+
+func Test_renderShell(t *testing.T) {
+	oid, _ := primitive.ObjectIDFromHex("5f0c5b7e9d1b2c3d4e5f6a7b")
+	d128, _ := primitive.ParseDecimal128("1.5")
+
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{name: "nil", v: nil, want: "null"},
+		{name: "ObjectId", v: oid, want: `ObjectId("5f0c5b7e9d1b2c3d4e5f6a7b")`},
+		{name: "Decimal128", v: d128, want: `NumberDecimal("1.5")`},
+		{name: "float", v: 1.5, want: "1.5"},
+		{name: "quoted key", v: primitive.D{{Key: "a.b", Value: true}}, want: `{ "a.b": true }`},
+		{name: "coordinates", v: []float64{-73.9, 40.7}, want: "[-73.9, 40.7]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderShell(tt.v); got != tt.want {
+				t.Errorf("renderShell() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,687 @@
+package querybuilder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// GeoIndex2D is an index of legacy coordinate pairs ([lon, lat] arrays)
+	GeoIndex2D = "2d"
+
+	// GeoIndex2DSphere is an index of GeoJSON objects on a sphere
+	GeoIndex2DSphere = "2dsphere"
+
+	// radius used to convert distances to radians for spherical queries
+	earthRadiusMeters = 6378100.0
+
+	// base32 alphabet used by geohashes
+	geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+	defaultDistanceField = "distance"
+)
+
+var geoDistanceUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"mi": 1609.344,
+}
+
+// SetGeoIndex configures a field as a geo field, using the type of index on the
+// field (GeoIndex2D or GeoIndex2DSphere) to determine the operators and units
+// of geo filters. Fields can also be configured within the schema using a
+// geoIndex annotation (i.e. "geoIndex": "2dsphere"), though MongoDB does not
+// permit unknown keywords in schemas used as collection validators.
+func (qb *QueryBuilder) SetGeoIndex(field string, index string) *QueryBuilder {
+	if qb.geoIndexes == nil {
+		qb.geoIndexes = map[string]string{}
+	}
+
+	qb.geoIndexes[qb.storedField(field)] = index
+
+	return qb
+}
+
+// geoIndex returns the type of geo index for the stored field... fields with
+// the legacy geo bsonType are treated as 2dsphere fields
+func (qb QueryBuilder) geoIndex(field string, bsonType string) (string, bool) {
+	if index, ok := qb.geoIndexes[field]; ok {
+		return index, true
+	}
+
+	if bsonType == "geo" {
+		return GeoIndex2DSphere, true
+	}
+
+	return "", false
+}
+
+// detectGeoComparisonOperator builds a geo query for the field using one of
+// the following forms (coordinates are always longitude then latitude, and
+// distances accept an m, km or mi unit suffix, defaulting to meters):
+//
+// * near:<lon>,<lat>[,<maxDistance>[,<minDistance>]]
+// * within:circle:<lon>,<lat>,<radius>
+// * within:polygon:<lon>,<lat>,<lon>,<lat>,<lon>,<lat>[,...]
+// * within:<GeoJSON Polygon or MultiPolygon>
+// * within:bbox:<minLon>,<minLat>,<maxLon>,<maxLat> (or bbox:...)
+// * within:geohash:<geohash> (or geohash:...)
+// * intersects:<GeoJSON geometry>
+//
+// Bounding boxes with a minimum longitude greater than the maximum longitude
+// cross the antimeridian.
+//
+// The legacy forms of <lat>,<lon>,<maxDistance> and <lat>,<lon>,<lat>,<lon>,
+// (a box) are supported as well.
+func detectGeoComparisonOperator(field string, values []string, index string) ([]Node, error) {
+	// values are separated by commas in the querystring
+	value := strings.Join(values, ",")
+
+	switch {
+	case strings.HasPrefix(value, "near:"):
+		return processNearOperator(field, strings.TrimPrefix(value, "near:"), index)
+	case strings.HasPrefix(value, "within:"):
+		return processWithinOperator(field, strings.TrimPrefix(value, "within:"), index)
+	case strings.HasPrefix(value, "intersects:"):
+		return processIntersectsOperator(field, strings.TrimPrefix(value, "intersects:"), index)
+	case strings.HasPrefix(value, "bbox:"), strings.HasPrefix(value, "geohash:"):
+		return processWithinOperator(field, value, index)
+	}
+
+	switch len(values) {
+	case 5:
+		// lat1, lon1, lat2, lon2 (the fifth value is not used)
+		coords, err := parseGeoValues(values[0:4])
+		if err != nil {
+			return nil, err
+		}
+
+		min, err := geoPosition(coords[1], coords[0])
+		if err != nil {
+			return nil, err
+		}
+
+		max, err := geoPosition(coords[3], coords[2])
+		if err != nil {
+			return nil, err
+		}
+
+		return processBoxOperator(field, min, max, index), nil
+	case 3:
+		// lat, lon, radius
+		return processNearOperator(field, strings.Join([]string{values[1], values[0], values[2]}, ","), index)
+	default:
+		return nil, fmt.Errorf("unsupported geo filter %q", value)
+	}
+}
+
+func processNearOperator(field string, value string, index string) ([]Node, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) < 2 || len(parts) > 4 {
+		return nil, errors.New("near requires a longitude, latitude and optional max and min distances")
+	}
+
+	coords, err := parseGeoValues(parts[0:2])
+	if err != nil {
+		return nil, err
+	}
+
+	point, err := geoPosition(coords[0], coords[1])
+	if err != nil {
+		return nil, err
+	}
+
+	distances := []float64{}
+	for _, part := range parts[2:] {
+		d, err := parseGeoDistance(part)
+		if err != nil {
+			return nil, err
+		}
+
+		distances = append(distances, d)
+	}
+
+	// legacy coordinate pairs use distances in radians
+	if index == GeoIndex2D {
+		nodes := []Node{Condition{Field: field, Operator: "$nearSphere", Value: point}}
+		if len(distances) > 0 {
+			nodes = append(nodes, Condition{Field: field, Operator: "$maxDistance", Value: distances[0] / earthRadiusMeters})
+		}
+
+		if len(distances) > 1 {
+			nodes = append(nodes, Condition{Field: field, Operator: "$minDistance", Value: distances[1] / earthRadiusMeters})
+		}
+
+		return nodes, nil
+	}
+
+	near := bson.M{"$geometry": geoPoint(point)}
+	if len(distances) > 0 {
+		near["$maxDistance"] = distances[0]
+	}
+
+	if len(distances) > 1 {
+		near["$minDistance"] = distances[1]
+	}
+
+	return []Node{Condition{Field: field, Operator: "$nearSphere", Value: near}}, nil
+}
+
+func processWithinOperator(field string, value string, index string) ([]Node, error) {
+	switch {
+	case strings.HasPrefix(value, "circle:"):
+		parts := strings.Split(strings.TrimPrefix(value, "circle:"), ",")
+		if len(parts) != 3 {
+			return nil, errors.New("circle requires a longitude, latitude and radius")
+		}
+
+		coords, err := parseGeoValues(parts[0:2])
+		if err != nil {
+			return nil, err
+		}
+
+		center, err := geoPosition(coords[0], coords[1])
+		if err != nil {
+			return nil, err
+		}
+
+		radius, err := parseGeoDistance(parts[2])
+		if err != nil {
+			return nil, err
+		}
+
+		return []Node{Condition{Field: field, Operator: "$geoWithin", Value: bson.M{
+			"$centerSphere": bson.A{center, radius / earthRadiusMeters},
+		}}}, nil
+	case strings.HasPrefix(value, "polygon:"):
+		coords, err := parseGeoValues(strings.Split(strings.TrimPrefix(value, "polygon:"), ","))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(coords)%2 != 0 || len(coords) < 6 {
+			return nil, errors.New("polygon requires at least three longitude and latitude pairs")
+		}
+
+		ring := [][]float64{}
+		for i := 0; i < len(coords); i += 2 {
+			position, err := geoPosition(coords[i], coords[i+1])
+			if err != nil {
+				return nil, err
+			}
+
+			ring = append(ring, position)
+		}
+
+		// legacy polygons are closed implicitly
+		if index == GeoIndex2D {
+			return []Node{Condition{Field: field, Operator: "$geoWithin", Value: bson.M{
+				"$polygon": ring,
+			}}}, nil
+		}
+
+		// GeoJSON polygons must be closed
+		if first, last := ring[0], ring[len(ring)-1]; first[0] != last[0] || first[1] != last[1] {
+			ring = append(ring, first)
+		}
+
+		return []Node{Condition{Field: field, Operator: "$geoWithin", Value: bson.M{
+			"$geometry": bson.M{
+				"type":        "Polygon",
+				"coordinates": [][][]float64{ring},
+			},
+		}}}, nil
+	case strings.HasPrefix(value, "bbox:"):
+		// OGC style bounding boxes may include a minimum and maximum elevation
+		coords, err := parseGeoValues(strings.Split(strings.TrimPrefix(value, "bbox:"), ","))
+		if err != nil {
+			return nil, err
+		}
+
+		switch len(coords) {
+		case 4:
+		case 6:
+			coords = []float64{coords[0], coords[1], coords[3], coords[4]}
+		default:
+			return nil, errors.New("bbox requires a minimum longitude, minimum latitude, maximum longitude and maximum latitude")
+		}
+
+		min, err := geoPosition(coords[0], coords[1])
+		if err != nil {
+			return nil, err
+		}
+
+		max, err := geoPosition(coords[2], coords[3])
+		if err != nil {
+			return nil, err
+		}
+
+		if min[1] > max[1] {
+			return nil, errors.New("bbox minimum latitude is greater than the maximum latitude")
+		}
+
+		return processBoxOperator(field, min, max, index), nil
+	case strings.HasPrefix(value, "geohash:"):
+		min, max, err := decodeGeohash(strings.TrimPrefix(value, "geohash:"))
+		if err != nil {
+			return nil, err
+		}
+
+		return processBoxOperator(field, min, max, index), nil
+	case strings.HasPrefix(value, "{"):
+		geometry, err := parseGeoJSON(value, index)
+		if err != nil {
+			return nil, err
+		}
+
+		if t := geometry["type"]; t != "Polygon" && t != "MultiPolygon" {
+			return nil, fmt.Errorf("within requires a Polygon or MultiPolygon, not %s", t)
+		}
+
+		return []Node{Condition{Field: field, Operator: "$geoWithin", Value: bson.M{
+			"$geometry": geometry,
+		}}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported within filter %q", value)
+	}
+}
+
+func processIntersectsOperator(field string, value string, index string) ([]Node, error) {
+	geometry, err := parseGeoJSON(value, index)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Node{Condition{Field: field, Operator: "$geoIntersects", Value: bson.M{
+		"$geometry": geometry,
+	}}}, nil
+}
+
+// processBoxOperator builds a $geoWithin query for the box with the bottom
+// left (min) and top right (max) corners... boxes that cross the antimeridian
+// are split into two boxes
+func processBoxOperator(field string, min []float64, max []float64, index string) []Node {
+	boxes := [][][]float64{{min, max}}
+	if min[0] > max[0] {
+		boxes = [][][]float64{
+			{min, {180, max[1]}},
+			{{-180, min[1]}, max},
+		}
+	}
+
+	if index == GeoIndex2D {
+		if len(boxes) == 1 {
+			return []Node{Condition{Field: field, Operator: "$geoWithin", Value: bson.M{
+				"$box": bson.A{min, max},
+			}}}
+		}
+
+		either := Group{Operator: "$or"}
+		for _, box := range boxes {
+			either.Nodes = append(either.Nodes, Group{Operator: "$and", Nodes: []Node{
+				Condition{Field: field, Operator: "$geoWithin", Value: bson.M{"$box": bson.A{box[0], box[1]}}},
+			}})
+		}
+
+		return []Node{either}
+	}
+
+	polygons := [][][][]float64{}
+	for _, box := range boxes {
+		polygons = append(polygons, spherePolygons(box[0], box[1])...)
+	}
+
+	geometry := bson.M{
+		"type":        "Polygon",
+		"coordinates": polygons[0],
+	}
+
+	if len(polygons) > 1 {
+		geometry = bson.M{
+			"type":        "MultiPolygon",
+			"coordinates": polygons,
+		}
+	}
+
+	return []Node{Condition{Field: field, Operator: "$geoWithin", Value: bson.M{
+		"$geometry": geometry,
+	}}}
+}
+
+// spherePolygons returns the polygons for a box on a sphere... the edges of a
+// polygon are geodesics, so boxes at least 180 degrees wide are split into
+// polygons narrower than 180 degrees, boxes spanning both poles are split at
+// the equator, and corners at a pole are collapsed into a single position
+func spherePolygons(min []float64, max []float64) [][][][]float64 {
+	width := max[0] - min[0]
+	n := int(width/180) + 1
+
+	bands := [][]float64{{min[1], max[1]}}
+	if min[1] == -90 && max[1] == 90 {
+		bands = [][]float64{{-90, 0}, {0, 90}}
+	}
+
+	polygons := [][][][]float64{}
+	for i := 0; i < n; i++ {
+		lo := min[0] + width*float64(i)/float64(n)
+		hi := min[0] + width*float64(i+1)/float64(n)
+		if i == n-1 {
+			hi = max[0]
+		}
+
+		for _, band := range bands {
+			bottom, top := band[0], band[1]
+
+			ring := [][]float64{{lo, bottom}}
+			if bottom != -90 {
+				ring = append(ring, []float64{hi, bottom})
+			}
+
+			ring = append(ring, []float64{hi, top})
+			if top != 90 {
+				ring = append(ring, []float64{lo, top})
+			}
+
+			polygons = append(polygons, [][][]float64{append(ring, []float64{lo, bottom})})
+		}
+	}
+
+	return polygons
+}
+
+// decodeGeohash returns the bottom left and top right corners of the area
+// described by the geohash
+func decodeGeohash(hash string) ([]float64, []float64, error) {
+	if hash == "" {
+		return nil, nil, errors.New("geohash is empty")
+	}
+
+	lon := []float64{-180, 180}
+	lat := []float64{-90, 90}
+	even := true
+
+	for _, c := range strings.ToLower(hash) {
+		idx := strings.IndexRune(geohashAlphabet, c)
+		if idx < 0 {
+			return nil, nil, fmt.Errorf("invalid geohash character %q", c)
+		}
+
+		// each character encodes 5 bits, alternating longitude and latitude
+		for bit := 4; bit >= 0; bit-- {
+			interval := lat
+			if even {
+				interval = lon
+			}
+
+			mid := (interval[0] + interval[1]) / 2
+			if idx&(1<<uint(bit)) != 0 {
+				interval[0] = mid
+			} else {
+				interval[1] = mid
+			}
+
+			even = !even
+		}
+	}
+
+	return []float64{lon[0], lat[0]}, []float64{lon[1], lat[1]}, nil
+}
+
+// parseGeoJSON parses and validates a GeoJSON geometry (GeoJSON is only
+// supported by 2dsphere indexes)
+func parseGeoJSON(value string, index string) (bson.M, error) {
+	if index == GeoIndex2D {
+		return nil, errors.New("GeoJSON geometries require a 2dsphere index")
+	}
+
+	g := struct {
+		Type        string          `json:"type"`
+		Coordinates json.RawMessage `json:"coordinates"`
+	}{}
+	if err := json.Unmarshal([]byte(value), &g); err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+
+	var coordinates interface{}
+	var positions [][]float64
+	switch g.Type {
+	case "Point":
+		c := []float64{}
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return nil, fmt.Errorf("invalid GeoJSON coordinates: %w", err)
+		}
+		coordinates, positions = c, [][]float64{c}
+	case "LineString", "MultiPoint":
+		c := [][]float64{}
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return nil, fmt.Errorf("invalid GeoJSON coordinates: %w", err)
+		}
+		coordinates, positions = c, c
+	case "Polygon", "MultiLineString":
+		c := [][][]float64{}
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return nil, fmt.Errorf("invalid GeoJSON coordinates: %w", err)
+		}
+		for _, ring := range c {
+			if g.Type == "Polygon" {
+				if err := validateLinearRing(ring); err != nil {
+					return nil, err
+				}
+			}
+			positions = append(positions, ring...)
+		}
+		coordinates = c
+	case "MultiPolygon":
+		c := [][][][]float64{}
+		if err := json.Unmarshal(g.Coordinates, &c); err != nil {
+			return nil, fmt.Errorf("invalid GeoJSON coordinates: %w", err)
+		}
+		for _, polygon := range c {
+			for _, ring := range polygon {
+				if err := validateLinearRing(ring); err != nil {
+					return nil, err
+				}
+				positions = append(positions, ring...)
+			}
+		}
+		coordinates = c
+	default:
+		return nil, fmt.Errorf("unsupported GeoJSON type %q", g.Type)
+	}
+
+	for _, position := range positions {
+		if len(position) < 2 {
+			return nil, errors.New("GeoJSON positions require a longitude and latitude")
+		}
+
+		if _, err := geoPosition(position[0], position[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return bson.M{
+		"type":        g.Type,
+		"coordinates": coordinates,
+	}, nil
+}
+
+func validateLinearRing(ring [][]float64) error {
+	if len(ring) < 4 {
+		return errors.New("polygon rings require at least four positions")
+	}
+
+	first, last := ring[0], ring[len(ring)-1]
+	if len(first) < 2 || len(last) < 2 || first[0] != last[0] || first[1] != last[1] {
+		return errors.New("polygon rings must be closed")
+	}
+
+	return nil
+}
+
+// geoPosition validates the longitude and latitude of a position
+func geoPosition(lon float64, lat float64) ([]float64, error) {
+	if !isFinite(lon) || lon < -180 || lon > 180 {
+		return nil, fmt.Errorf("longitude %v is out of range", lon)
+	}
+
+	if !isFinite(lat) || lat < -90 || lat > 90 {
+		return nil, fmt.Errorf("latitude %v is out of range", lat)
+	}
+
+	return []float64{lon, lat}, nil
+}
+
+// isFinite determines whether a coordinate or distance is a number (NaN fails
+// every range comparison) and is not infinite
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+func geoPoint(position []float64) bson.M {
+	return bson.M{
+		"type":        "Point",
+		"coordinates": position,
+	}
+}
+
+func parseGeoValues(values []string) ([]float64, error) {
+	coords := []float64{}
+	for i, value := range values {
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || !isFinite(v) {
+			return nil, fmt.Errorf("incorrect value: part %d is not float", i+1)
+		}
+
+		coords = append(coords, v)
+	}
+
+	return coords, nil
+}
+
+// parseGeoDistance parses a distance with an optional unit suffix (m, km or
+// mi) and returns the distance in meters
+func parseGeoDistance(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+
+	multiplier := 1.0
+	for _, unit := range []string{"km", "mi", "m"} {
+		if strings.HasSuffix(value, unit) {
+			multiplier = geoDistanceUnits[unit]
+			value = strings.TrimSuffix(value, unit)
+			break
+		}
+	}
+
+	d, err := strconv.ParseFloat(value, 64)
+	if err != nil || !isFinite(d) || d < 0 {
+		return 0, fmt.Errorf("incorrect distance %q", value)
+	}
+
+	return d * multiplier, nil
+}
+
+// SetDistanceField configures the field that the calculated distance (in
+// meters) of each document is output to by the $geoNear stage of pipelines
+// built for near filters (defaults to distance)
+func (qb *QueryBuilder) SetDistanceField(field string) *QueryBuilder {
+	qb.distanceField = field
+
+	return qb
+}
+
+func (qb QueryBuilder) distanceFieldName() string {
+	if qb.distanceField == "" {
+		return defaultDistanceField
+	}
+
+	return qb.distanceField
+}
+
+// geoNearStage creates a $geoNear stage from the near clause of the filter,
+// using the remaining clauses of the filter as the query for the stage
+func (qb QueryBuilder) geoNearStage(filter bson.M) (bson.D, bool) {
+	for field, value := range filter {
+		d, ok := value.(bson.D)
+		if !ok {
+			continue
+		}
+
+		clause := d.Map()
+		if clause["$nearSphere"] == nil {
+			continue
+		}
+
+		// GeoJSON points use distances in meters, legacy coordinate pairs
+		// use radians (converted to meters with the distance multiplier)
+		near, geoJSON := clause["$nearSphere"].(bson.M)
+		point := clause["$nearSphere"]
+		if geoJSON {
+			point = near["$geometry"]
+		} else {
+			near = clause
+		}
+
+		stage := bson.D{
+			{Key: "near", Value: point},
+			{Key: "distanceField", Value: qb.distanceFieldName()},
+			{Key: "key", Value: field},
+			{Key: "spherical", Value: true},
+		}
+
+		if d, ok := near["$maxDistance"]; ok {
+			stage = append(stage, bson.E{Key: "maxDistance", Value: d})
+		}
+
+		if d, ok := near["$minDistance"]; ok {
+			stage = append(stage, bson.E{Key: "minDistance", Value: d})
+		}
+
+		if !geoJSON {
+			stage = append(stage, bson.E{Key: "distanceMultiplier", Value: earthRadiusMeters})
+		}
+
+		// fold the remaining filter into the query of the stage
+		query := bson.M{}
+		for k, v := range filter {
+			if k != field {
+				query[k] = v
+			}
+		}
+
+		if len(query) > 0 {
+			stage = append(stage, bson.E{Key: "query", Value: query})
+		}
+
+		return bson.D{{Key: "$geoNear", Value: stage}}, true
+	}
+
+	return nil, false
+}
+
+// includeDistanceField adds the distance field to projections that include
+// specific fields
+func (qb QueryBuilder) includeDistanceField(opts *options.FindOptions) {
+	switch prj := opts.Projection.(type) {
+	case map[string]int:
+		for _, val := range prj {
+			if val == 1 {
+				prj[qb.distanceFieldName()] = 1
+				return
+			}
+		}
+	case bson.M:
+		for _, val := range prj {
+			if val == 1 {
+				prj[qb.distanceFieldName()] = 1
+				return
+			}
+		}
+	}
+}
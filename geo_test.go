@@ -0,0 +1,310 @@
+package querybuilder
+
+import (
+	"reflect"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestQueryBuilder_SetGeoIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		qs      string
+		want    bson.M
+		wantErr bool
+	}{
+		{
+			name: "should build $nearSphere with GeoJSON point and distances in meters",
+			qs:   "filter[location]=near:-73.9,40.7,5km,100",
+			want: bson.M{"location": bson.D{{Key: "$nearSphere", Value: bson.M{
+				"$geometry":    bson.M{"type": "Point", "coordinates": []float64{-73.9, 40.7}},
+				"$maxDistance": 5000.0,
+				"$minDistance": 100.0,
+			}}}},
+		},
+		{
+			name: "should build $nearSphere with legacy pairs and distances in radians",
+			qs:   "filter[legacy]=near:-73.9,40.7,6378.1km",
+			want: bson.M{"legacy": bson.D{
+				{Key: "$nearSphere", Value: []float64{-73.9, 40.7}},
+				{Key: "$maxDistance", Value: 1.0},
+			}},
+		},
+		{
+			name: "should order legacy lat, lon and radius filters as GeoJSON",
+			qs:   "filter[location]=40.7,-73.9,100",
+			want: bson.M{"location": bson.D{{Key: "$nearSphere", Value: bson.M{
+				"$geometry":    bson.M{"type": "Point", "coordinates": []float64{-73.9, 40.7}},
+				"$maxDistance": 100.0,
+			}}}},
+		},
+		{
+			name: "should build $centerSphere with radius in radians",
+			qs:   "filter[location]=within:circle:-73.9,40.7,6378.1km",
+			want: bson.M{"location": bson.D{{Key: "$geoWithin", Value: bson.M{
+				"$centerSphere": bson.A{[]float64{-73.9, 40.7}, 1.0},
+			}}}},
+		},
+		{
+			name: "should build closed GeoJSON polygons",
+			qs:   "filter[location]=within:polygon:0,0,10,0,10,10",
+			want: bson.M{"location": bson.D{{Key: "$geoWithin", Value: bson.M{
+				"$geometry": bson.M{
+					"type":        "Polygon",
+					"coordinates": [][][]float64{{{0, 0}, {10, 0}, {10, 10}, {0, 0}}},
+				},
+			}}}},
+		},
+		{
+			name: "should build legacy polygons for 2d indexes",
+			qs:   "filter[legacy]=within:polygon:0,0,10,0,10,10",
+			want: bson.M{"legacy": bson.D{{Key: "$geoWithin", Value: bson.M{
+				"$polygon": [][]float64{{0, 0}, {10, 0}, {10, 10}},
+			}}}},
+		},
+		{
+			name: "should accept GeoJSON for $geoIntersects",
+			qs:   `filter[location]=intersects:{"type":"LineString","coordinates":[[0,0],[5,5]]}`,
+			want: bson.M{"location": bson.D{{Key: "$geoIntersects", Value: bson.M{
+				"$geometry": bson.M{
+					"type":        "LineString",
+					"coordinates": [][]float64{{0, 0}, {5, 5}},
+				},
+			}}}},
+		},
+		{
+			name: "should build polygons for bounding boxes",
+			qs:   "filter[location]=bbox:-10,-5,10,5",
+			want: bson.M{"location": bson.D{{Key: "$geoWithin", Value: bson.M{
+				"$geometry": bson.M{
+					"type":        "Polygon",
+					"coordinates": [][][]float64{{{-10, -5}, {10, -5}, {10, 5}, {-10, 5}, {-10, -5}}},
+				},
+			}}}},
+		},
+		{
+			name: "should ignore elevation in OGC bounding boxes",
+			qs:   "filter[legacy]=within:bbox:-10,-5,0,10,5,100",
+			want: bson.M{"legacy": bson.D{{Key: "$geoWithin", Value: bson.M{
+				"$box": bson.A{[]float64{-10, -5}, []float64{10, 5}},
+			}}}},
+		},
+		{
+			name: "should split bounding boxes that cross the antimeridian",
+			qs:   "filter[location]=bbox:170,-5,-170,5",
+			want: bson.M{"location": bson.D{{Key: "$geoWithin", Value: bson.M{
+				"$geometry": bson.M{
+					"type": "MultiPolygon",
+					"coordinates": [][][][]float64{
+						{{{170, -5}, {180, -5}, {180, 5}, {170, 5}, {170, -5}}},
+						{{{-180, -5}, {-170, -5}, {-170, 5}, {-180, 5}, {-180, -5}}},
+					},
+				},
+			}}}},
+		},
+		{
+			name: "should split bounding boxes of the whole world",
+			qs:   "filter[location]=bbox:-180,-90,180,90",
+			want: bson.M{"location": bson.D{{Key: "$geoWithin", Value: bson.M{
+				"$geometry": bson.M{
+					"type": "MultiPolygon",
+					"coordinates": [][][][]float64{
+						{{{-180, -90}, {-60, 0}, {-180, 0}, {-180, -90}}},
+						{{{-180, 0}, {-60, 0}, {-60, 90}, {-180, 0}}},
+						{{{-60, -90}, {60, 0}, {-60, 0}, {-60, -90}}},
+						{{{-60, 0}, {60, 0}, {60, 90}, {-60, 0}}},
+						{{{60, -90}, {180, 0}, {60, 0}, {60, -90}}},
+						{{{60, 0}, {180, 0}, {180, 90}, {60, 0}}},
+					},
+				},
+			}}}},
+		},
+		{
+			name: "should split bounding boxes at least 180 degrees wide",
+			qs:   "filter[location]=bbox:-179,-80,179,80",
+			want: bson.M{"location": bson.D{{Key: "$geoWithin", Value: bson.M{
+				"$geometry": bson.M{
+					"type": "MultiPolygon",
+					"coordinates": [][][][]float64{
+						{{{-179, -80}, {0, -80}, {0, 80}, {-179, 80}, {-179, -80}}},
+						{{{0, -80}, {179, -80}, {179, 80}, {0, 80}, {0, -80}}},
+					},
+				},
+			}}}},
+		},
+		{
+			name: "should split legacy bounding boxes that cross the antimeridian",
+			qs:   "filter[legacy]=bbox:170,-5,-170,5&filter[name]=bob",
+			want: bson.M{
+				"$or": bson.A{
+					bson.M{"legacy": bson.D{{Key: "$geoWithin", Value: bson.M{"$box": bson.A{[]float64{170, -5}, []float64{180, 5}}}}}},
+					bson.M{"legacy": bson.D{{Key: "$geoWithin", Value: bson.M{"$box": bson.A{[]float64{-180, -5}, []float64{-170, 5}}}}}},
+				},
+				"name": "bob",
+			},
+		},
+		{
+			name: "should decode geohashes to bounding boxes",
+			qs:   "filter[legacy]=geohash:s",
+			want: bson.M{"legacy": bson.D{{Key: "$geoWithin", Value: bson.M{
+				"$box": bson.A{[]float64{0, 0}, []float64{45, 45}},
+			}}}},
+		},
+		{
+			name:    "should reject invalid geohashes",
+			qs:      "filter[location]=within:geohash:abc",
+			wantErr: true,
+		},
+		{
+			name:    "should reject bounding boxes with inverted latitudes",
+			qs:      "filter[location]=bbox:-10,5,10,-5",
+			wantErr: true,
+		},
+		{
+			name:    "should reject GeoJSON for 2d indexes",
+			qs:      `filter[legacy]=intersects:{"type":"Point","coordinates":[0,0]}`,
+			wantErr: true,
+		},
+		{
+			name:    "should reject unclosed GeoJSON polygons",
+			qs:      `filter[location]=within:{"type":"Polygon","coordinates":[[[0,0],[5,0],[5,5],[0,5]]]}`,
+			wantErr: true,
+		},
+		{
+			name:    "should reject coordinates that are out of range",
+			qs:      "filter[location]=near:40.7,-173.9",
+			wantErr: true,
+		},
+		{
+			name:    "should reject coordinates that are not numbers",
+			qs:      "filter[location]=near:NaN,NaN",
+			wantErr: true,
+		},
+		{
+			name:    "should reject legacy coordinates that are infinite",
+			qs:      "filter[legacy]=bbox:-Inf,0,Inf,10",
+			wantErr: true,
+		},
+		{
+			name:    "should reject distances that are not numbers",
+			qs:      "filter[location]=near:-73.9,40.7,NaNkm",
+			wantErr: true,
+		},
+		{
+			name:    "should reject invalid distances",
+			qs:      "filter[location]=near:-73.9,40.7,5furlongs",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := NewQueryBuilder("test", bson.M{
+				"$jsonSchema": bson.M{
+					"properties": bson.M{
+						"location": bson.M{
+							"bsonType": "object",
+							"geoIndex": "2dsphere",
+						},
+						"name": bson.M{
+							"bsonType": "string",
+						},
+					},
+				},
+			}).SetGeoIndex("legacy", GeoIndex2D)
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			got, err := qb.Filter(qo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryBuilder.Filter() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryBuilder.Filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryBuilder_SetDistanceField(t *testing.T) {
+	var el int64 = 10
+
+	tests := []struct {
+		name          string
+		distanceField string
+		qs            string
+		want          mongo.Pipeline
+	}{
+		{
+			name: "should emit a leading $geoNear stage with other filters as its query",
+			qs:   "filter[location]=near:-73.9,40.7,5km&filter[name]=bob&fields=name&page[limit]=10",
+			want: mongo.Pipeline{
+				{{Key: "$geoNear", Value: bson.D{
+					{Key: "near", Value: bson.M{"type": "Point", "coordinates": []float64{-73.9, 40.7}}},
+					{Key: "distanceField", Value: "distance"},
+					{Key: "key", Value: "location"},
+					{Key: "spherical", Value: true},
+					{Key: "maxDistance", Value: 5000.0},
+					{Key: "query", Value: bson.M{"name": "bob", "deletedAt": nil}},
+				}}},
+				{{Key: "$limit", Value: el}},
+				{{Key: "$project", Value: map[string]int{"name": 1, "distance": 1}}},
+			},
+		},
+		{
+			name:          "should convert legacy distances to meters and retain custom sorts",
+			distanceField: "dist",
+			qs:            "filter[legacy]=near:-73.9,40.7,0.5km,100&sort=name",
+			want: mongo.Pipeline{
+				{{Key: "$geoNear", Value: bson.D{
+					{Key: "near", Value: []float64{-73.9, 40.7}},
+					{Key: "distanceField", Value: "dist"},
+					{Key: "key", Value: "legacy"},
+					{Key: "spherical", Value: true},
+					{Key: "maxDistance", Value: 500 / earthRadiusMeters},
+					{Key: "minDistance", Value: 100 / earthRadiusMeters},
+					{Key: "distanceMultiplier", Value: earthRadiusMeters},
+					{Key: "query", Value: bson.M{"deletedAt": nil}},
+				}}},
+				{{Key: "$sort", Value: bson.D{{Key: "name", Value: 1}}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := (&QueryBuilder{
+				collection: "test",
+				fieldTypes: map[string]string{"name": "string"},
+			}).
+				SetGeoIndex("location", GeoIndex2DSphere).
+				SetGeoIndex("legacy", GeoIndex2D).
+				SetDistanceField(tt.distanceField).
+				SetDefaultSort("name").
+				AddScope(bson.M{"deletedAt": nil})
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			got, err := qb.Pipeline(qo)
+			if err != nil {
+				t.Errorf("QueryBuilder.Pipeline() error = %v", err)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryBuilder.Pipeline() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package querybuilder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrQueryTooComplex is wrapped by the errors returned when a query exceeds
+// any of the Limits configured for the QueryBuilder
+var ErrQueryTooComplex = errors.New("query is too complex")
+
+// relative cost of each portion of a query (see Cost)
+const (
+	costEquality        = 1
+	costInValue         = 1
+	costRange           = 2
+	costNegation        = 5
+	costAnchoredRegex   = 2
+	costInsensitive     = 10
+	costUnanchoredRegex = 25
+	costGeo             = 10
+	costSortKey         = 2
+	costUnboundedPage   = 10
+)
+
+// Limits restricts the complexity of the queries that the QueryBuilder will
+// build. A zero value for any of the limits disables it.
+type Limits struct {
+	// MaxFilterFields is the maximum number of fields that may be filtered on
+	MaxFilterFields int
+
+	// MaxValuesPerField is the maximum number of values (i.e. for an $in) that
+	// may be provided for a single filter field
+	MaxValuesPerField int
+
+	// MaxRegexClauses is the maximum number of regular expressions (begins
+	// with, ends with and contains filters) in a single filter
+	MaxRegexClauses int
+
+	// MaxPageSize is the maximum value for a page limit or size... as with
+	// Pagination.MaxSize (the smaller of the two applies), larger values are
+	// clamped unless strict validation is enabled
+	MaxPageSize int
+
+	// MaxSortKeys is the maximum number of fields that may be sorted on
+	MaxSortKeys int
+
+	// MaxDepth is the maximum number of path segments (i.e. 3 for a.b.c) for
+	// any field used in a filter
+	MaxDepth int
+
+	// MaxCost is the maximum estimated cost (see Cost) of a query
+	MaxCost int
+}
+
+// SetLimits configures limits for the complexity of queries built by the
+// QueryBuilder... Filter and FindOptions return an error wrapping
+// ErrQueryTooComplex when a limit is exceeded, and CheckLimits can be used to
+// verify all limits (including MaxCost) before executing a query.
+func (qb *QueryBuilder) SetLimits(limits Limits) *QueryBuilder {
+	qb.limits = limits
+
+	return qb
+}
+
+// Cost estimates the relative cost of executing the query described by the
+// query options. Equality comparisons are the cheapest, while negations,
+// case-insensitive and unanchored regular expressions, geo queries, sorting
+// and unbounded pages add progressively more to the cost.
+func (qb QueryBuilder) Cost(qo queryoptions.Options) (int, error) {
+	return qb.CostContext(context.Background(), qo)
+}
+
+// CostContext estimates the relative cost of executing the query in the same
+// manner as Cost, applying any field policy and scopes configured for the
+// QueryBuilder to the caller identified by the provided context
+func (qb QueryBuilder) CostContext(ctx context.Context, qo queryoptions.Options) (int, error) {
+	filter, err := qb.FilterContext(ctx, qo)
+	if err != nil {
+		return 0, err
+	}
+
+	cost := clauseCost(filter)
+	cost += len(qo.Sort) * costSortKey
+
+	// pages without a limit (including the default and maximum sizes) may
+	// return the entire collection
+	opts := options.Find()
+	if err := qb.setPaginationOptions(qo.Page, opts); err != nil {
+		return 0, err
+	}
+
+	if opts.Limit == nil || *opts.Limit == 0 {
+		cost += costUnboundedPage
+	}
+
+	return cost, nil
+}
+
+// CheckLimits verifies the query options do not exceed any of the limits
+// configured for the QueryBuilder, including the maximum estimated cost
+func (qb QueryBuilder) CheckLimits(qo queryoptions.Options) error {
+	return qb.CheckLimitsContext(context.Background(), qo)
+}
+
+// CheckLimitsContext verifies the query options do not exceed any of the
+// limits in the same manner as CheckLimits, applying any field policy and
+// scopes configured for the QueryBuilder to the caller identified by the
+// provided context
+func (qb QueryBuilder) CheckLimitsContext(ctx context.Context, qo queryoptions.Options) error {
+	// building the filter verifies the filter limits
+	if _, err := qb.FilterContext(ctx, qo); err != nil {
+		return err
+	}
+
+	if err := qb.checkOptionsLimits(qo); err != nil {
+		return err
+	}
+
+	if err := qb.setPaginationOptions(qo.Page, options.Find()); err != nil {
+		return err
+	}
+
+	if qb.limits.MaxCost == 0 {
+		return nil
+	}
+
+	cost, err := qb.CostContext(ctx, qo)
+	if err != nil {
+		return err
+	}
+
+	return checkLimit("estimated query cost", cost, qb.limits.MaxCost)
+}
+
+// checkFilterLimits verifies the number of fields, values and depth of fields
+// provided in a filter
+func (qb QueryBuilder) checkFilterLimits(filter map[string][]string) error {
+	if err := checkLimit("filter fields", len(filter), qb.limits.MaxFilterFields); err != nil {
+		return err
+	}
+
+	for field, values := range filter {
+		if err := checkLimit(fmt.Sprintf("values for filter field %s", field), len(values), qb.limits.MaxValuesPerField); err != nil {
+			return err
+		}
+
+		path := strings.ReplaceAll(strings.ReplaceAll(field, ".[*]", ""), "[]", ".")
+		depth := len(strings.Split(qb.storedField(path), "."))
+		if err := checkLimit(fmt.Sprintf("depth of filter field %s", field), depth, qb.limits.MaxDepth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkClauseLimits verifies the number of regular expressions in a filter
+func (qb QueryBuilder) checkClauseLimits(filter bson.M) error {
+	return checkLimit("regex clauses", countRegexClauses(filter), qb.limits.MaxRegexClauses)
+}
+
+// checkOptionsLimits verifies the number of sort keys (the size of a page is
+// verified along with the other pagination options, see pageSize)
+func (qb QueryBuilder) checkOptionsLimits(qo queryoptions.Options) error {
+	return checkLimit("sort keys", len(qo.Sort), qb.limits.MaxSortKeys)
+}
+
+func checkLimit(name string, value int, limit int) error {
+	if limit > 0 && value > limit {
+		return fmt.Errorf("%w: %s (%d) exceeds the limit of %d", ErrQueryTooComplex, name, value, limit)
+	}
+
+	return nil
+}
+
+// clauseCost estimates the relative cost of each of the conditions within a
+// filter clause
+func clauseCost(v interface{}) int {
+	cost := 0
+
+	switch v := v.(type) {
+	case bson.M:
+		for key, value := range v {
+			cost += operatorCost(key, value)
+		}
+	case bson.D:
+		for _, e := range v {
+			cost += operatorCost(e.Key, e.Value)
+		}
+	case primitive.E:
+		cost += operatorCost(v.Key, v.Value)
+	case bson.A:
+		for _, value := range v {
+			cost += clauseCost(value)
+		}
+	case primitive.Regex:
+		cost += regexCost(v)
+	default:
+		cost += costEquality
+	}
+
+	return cost
+}
+
+func operatorCost(key string, value interface{}) int {
+	switch key {
+	case "$in", "$all":
+		if a, ok := value.(bson.A); ok {
+			return len(a) * costInValue
+		}
+		return costInValue
+	case "$lt", "$lte", "$gt", "$gte":
+		return costRange
+	case "$ne", "$nin", "$not", "$nor":
+		return costNegation
+	case "$exists":
+		if exists, ok := value.(bool); ok && !exists {
+			return costNegation
+		}
+		return costEquality
+	case "$near", "$nearSphere", "$geoWithin", "$geoIntersects":
+		return costGeo
+	}
+
+	return clauseCost(value)
+}
+
+func regexCost(re primitive.Regex) int {
+	if !strings.HasPrefix(re.Pattern, "^") {
+		return costUnanchoredRegex
+	}
+
+	// case-insensitive regular expressions cannot use an index efficiently
+	if strings.Contains(re.Options, "i") {
+		return costInsensitive
+	}
+
+	return costAnchoredRegex
+}
+
+func countRegexClauses(v interface{}) int {
+	count := 0
+
+	switch v := v.(type) {
+	case bson.M:
+		for _, value := range v {
+			count += countRegexClauses(value)
+		}
+	case bson.D:
+		for _, e := range v {
+			count += countRegexClauses(e.Value)
+		}
+	case primitive.E:
+		count += countRegexClauses(v.Value)
+	case bson.A:
+		for _, value := range v {
+			count += countRegexClauses(value)
+		}
+	case primitive.Regex:
+		count++
+	}
+
+	return count
+}
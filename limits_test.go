@@ -0,0 +1,209 @@
+package querybuilder
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+)
+
+func TestQueryBuilder_SetLimits(t *testing.T) {
+	fieldTypes := map[string]string{
+		"name":       "string",
+		"age":        "int",
+		"owner":      "object",
+		"owner.name": "string",
+	}
+
+	tests := []struct {
+		name             string
+		limits           Limits
+		strictValidation bool
+		qs               string
+		wantErr          bool
+	}{
+		{
+			name:   "should allow queries within limits",
+			limits: Limits{MaxFilterFields: 2, MaxValuesPerField: 3, MaxRegexClauses: 1, MaxPageSize: 100, MaxSortKeys: 1, MaxDepth: 2},
+			qs:     "filter[name]=bob*&filter[owner.name]=a,b,c&sort=name&page[limit]=100",
+		},
+		{
+			name:    "should limit filter fields",
+			limits:  Limits{MaxFilterFields: 1},
+			qs:      "filter[name]=bob&filter[age]=5",
+			wantErr: true,
+		},
+		{
+			name:    "should limit values per field",
+			limits:  Limits{MaxValuesPerField: 2},
+			qs:      "filter[age]=1,2,3",
+			wantErr: true,
+		},
+		{
+			name:    "should limit regex clauses",
+			limits:  Limits{MaxRegexClauses: 1},
+			qs:      "filter[name]=*bob*&filter[owner.name]=bob*",
+			wantErr: true,
+		},
+		{
+			name:             "should limit page size with strict validation",
+			limits:           Limits{MaxPageSize: 100},
+			strictValidation: true,
+			qs:               "page[limit]=10000000",
+			wantErr:          true,
+		},
+		{
+			name:   "should clamp page size",
+			limits: Limits{MaxPageSize: 100},
+			qs:     "page[limit]=10000000",
+		},
+		{
+			name:    "should limit sort keys",
+			limits:  Limits{MaxSortKeys: 1},
+			qs:      "sort=name,-age",
+			wantErr: true,
+		},
+		{
+			name:    "should limit depth of fields",
+			limits:  Limits{MaxDepth: 1},
+			qs:      "filter[owner.name]=bob",
+			wantErr: true,
+		},
+		{
+			name:    "should limit estimated cost",
+			limits:  Limits{MaxCost: 20},
+			qs:      "filter[name]=*bob*&page[limit]=10",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := (&QueryBuilder{
+				collection:       "test",
+				fieldTypes:       fieldTypes,
+				strictValidation: tt.strictValidation,
+			}).SetLimits(tt.limits)
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			err = qb.CheckLimits(qo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryBuilder.CheckLimits() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if err != nil && !errors.Is(err, ErrQueryTooComplex) {
+				t.Errorf("QueryBuilder.CheckLimits() error = %v, want ErrQueryTooComplex", err)
+			}
+		})
+	}
+}
+
+func TestQueryBuilder_Cost(t *testing.T) {
+	qb := QueryBuilder{
+		collection: "test",
+		fieldTypes: map[string]string{
+			"name": "string",
+			"age":  "int",
+		},
+	}
+
+	tests := []struct {
+		name       string
+		pagination Pagination
+		qs         string
+		want       int
+	}{
+		{
+			name: "should estimate equality comparisons",
+			qs:   "filter[name]=bob&page[limit]=10",
+			want: costEquality,
+		},
+		{
+			name: "should estimate $in values and ranges",
+			qs:   "filter[name]=a,b,c&filter[age]=>5&page[limit]=10",
+			want: 3*costInValue + costRange,
+		},
+		{
+			name: "should estimate regular expressions",
+			qs:   "filter[name]=*bob*&page[limit]=10",
+			want: costUnanchoredRegex,
+		},
+		{
+			name:       "should estimate pages bounded by the default size",
+			pagination: Pagination{DefaultSize: 25},
+			qs:         "filter[name]=bob",
+			want:       costEquality,
+		},
+		{
+			name:       "should estimate pages bounded by the maximum size",
+			pagination: Pagination{MaxSize: 50},
+			qs:         "filter[name]=bob&page[limit]=0",
+			want:       costEquality,
+		},
+		{
+			name: "should estimate sorting and unbounded pages",
+			qs:   "filter[age]=!=5&sort=name,age",
+			want: costNegation + 2*costSortKey + costUnboundedPage,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			qb.pagination = tt.pagination
+
+			got, err := qb.Cost(qo)
+			if err != nil {
+				t.Errorf("QueryBuilder.Cost() error = %v", err)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("QueryBuilder.Cost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryBuilder_CheckLimitsContext(t *testing.T) {
+	qb := (&QueryBuilder{
+		collection: "test",
+		fieldTypes: map[string]string{"name": "string"},
+	}).SetLimits(Limits{MaxCost: 20}).AddScopeFunc(testTenantScope)
+
+	qo, err := queryoptions.FromQuerystring("filter[name]=*bob*&page[limit]=10")
+	if err != nil {
+		t.Errorf("options.FromQuerystring() error = %v", err)
+		return
+	}
+
+	// the scope requires a tenant within the context
+	if err := qb.CheckLimits(qo); err == nil || errors.Is(err, ErrQueryTooComplex) {
+		t.Errorf("QueryBuilder.CheckLimits() error = %v, want scope error", err)
+	}
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, "a")
+	if err := qb.CheckLimitsContext(ctx, qo); !errors.Is(err, ErrQueryTooComplex) {
+		t.Errorf("QueryBuilder.CheckLimitsContext() error = %v, want ErrQueryTooComplex", err)
+	}
+
+	cost, err := qb.CostContext(ctx, qo)
+	if err != nil {
+		t.Errorf("QueryBuilder.CostContext() error = %v", err)
+		return
+	}
+
+	if want := costUnanchoredRegex + costEquality; cost != want {
+		t.Errorf("QueryBuilder.CostContext() = %v, want %v", cost, want)
+	}
+}
@@ -0,0 +1,139 @@
+package querybuilder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// bsonTypeAliases are the aliases accepted by the $type operator
+var bsonTypeAliases = map[string]bool{
+	"array":               true,
+	"binData":             true,
+	"bool":                true,
+	"date":                true,
+	"dbPointer":           true,
+	"decimal":             true,
+	"double":              true,
+	"int":                 true,
+	"javascript":          true,
+	"long":                true,
+	"maxKey":              true,
+	"minKey":              true,
+	"null":                true,
+	"number":              true,
+	"object":              true,
+	"objectId":            true,
+	"regex":               true,
+	"string":              true,
+	"symbol":              true,
+	"timestamp":           true,
+	"undefined":           true,
+	"javascriptWithScope": true,
+}
+
+// splitFieldModifier separates a modifier from the name of a filter field
+// (i.e. tags:size)
+func splitFieldModifier(field string) (string, string) {
+	idx := strings.LastIndex(field, ":")
+	if idx < 0 {
+		return field, ""
+	}
+
+	return field[:idx], field[idx+1:]
+}
+
+// detectModifierOperator builds the conditions for a filter field with a
+// modifier (i.e. tags:size)
+func (qb QueryBuilder) detectModifierOperator(name string, field string, modifier string, values []string, bsonType string) ([]Node, error) {
+	switch modifier {
+	case "all":
+		return qb.detectAllOperator(name, field, values, bsonType)
+	case "bitsAllClear", "bitsAllSet", "bitsAnyClear", "bitsAnySet":
+		return detectBitwiseOperator(field, fmt.Sprintf("$%s", modifier), values, bsonType)
+	case "dow", "hour", "month":
+		return qb.detectDatePartOperator(name, field, modifier, values, bsonType)
+	case "empty":
+		return detectEmptyOperator(field, values)
+	case "exists":
+		return detectExistsOperator(field, values, true)
+	case "isNull":
+		return detectIsNullOperator(field, values)
+	case "missing":
+		return detectExistsOperator(field, values, false)
+	case "mod":
+		return detectModuloOperator(field, values, bsonType)
+	case "size":
+		return detectSizeOperator(field, values)
+	case "type":
+		return detectTypeOperator(field, values)
+	}
+
+	if qb.strictValidation {
+		return nil, fmt.Errorf("unsupported modifier %s for field %s", modifier, name)
+	}
+
+	return nil, nil
+}
+
+// detectExistsOperator builds an $exists condition... when exists is false the
+// value is inverted (i.e. missing=true is equivalent to exists=false)
+func detectExistsOperator(field string, values []string, exists bool) ([]Node, error) {
+	v, err := parseModifierBool(field, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return []Node{Condition{Field: field, Operator: "$exists", Value: v == exists}}, nil
+}
+
+// detectIsNullOperator builds a condition matching values that are either
+// null or missing (when true) and values that are neither (when false)... use
+// the type modifier (i.e. field:type=null) to match values explicitly set to
+// null
+func detectIsNullOperator(field string, values []string) ([]Node, error) {
+	v, err := parseModifierBool(field, values)
+	if err != nil {
+		return nil, err
+	}
+
+	if v {
+		return []Node{Condition{Field: field, Operator: "$eq", Value: nil}}, nil
+	}
+
+	return []Node{Condition{Field: field, Operator: "$ne", Value: nil}}, nil
+}
+
+// detectTypeOperator builds a $type condition for one or more bson type aliases
+func detectTypeOperator(field string, values []string) ([]Node, error) {
+	a := bson.A{}
+	for _, value := range values {
+		if !bsonTypeAliases[value] {
+			return nil, fmt.Errorf("invalid type %s to filter field %s", value, field)
+		}
+
+		a = append(a, value)
+	}
+
+	if len(a) == 1 {
+		return []Node{Condition{Field: field, Operator: "$type", Value: a[0]}}, nil
+	}
+
+	return []Node{Condition{Field: field, Operator: "$type", Value: a}}, nil
+}
+
+// parseModifierBool parses the single boolean value of a filter modifier
+func parseModifierBool(field string, values []string) (bool, error) {
+	if len(values) != 1 {
+		return false, fmt.Errorf("a single value is required to filter field %s", field)
+	}
+
+	v, err := strconv.ParseBool(values[0])
+	if err != nil {
+		return false, fmt.Errorf("invalid value %s to filter field %s", values[0], field)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,131 @@
+package querybuilder
+
+import (
+	"reflect"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestQueryBuilder_detectModifierOperator(t *testing.T) {
+	tests := []struct {
+		name    string
+		qs      string
+		want    bson.M
+		wantErr bool
+	}{
+		{
+			name: "should use $exists for any field",
+			qs:   "filter[name:exists]=true",
+			want: bson.M{"name": bson.D{primitive.E{Key: "$exists", Value: true}}},
+		},
+		{
+			name: "should use $exists for object fields",
+			qs:   "filter[owner:exists]=false",
+			want: bson.M{"owner": bson.D{primitive.E{Key: "$exists", Value: false}}},
+		},
+		{
+			name: "should invert $exists for missing fields",
+			qs:   "filter[age:missing]=true",
+			want: bson.M{"age": bson.D{primitive.E{Key: "$exists", Value: false}}},
+		},
+		{
+			name: "should match null or missing values",
+			qs:   "filter[age:isNull]=true",
+			want: bson.M{"age": nil},
+		},
+		{
+			name: "should match values that are neither null nor missing",
+			qs:   "filter[age:isNull]=false",
+			want: bson.M{"age": bson.D{primitive.E{Key: "$ne", Value: nil}}},
+		},
+		{
+			name: "should use $type to match explicit null values",
+			qs:   "filter[age:type]=null",
+			want: bson.M{"age": bson.D{primitive.E{Key: "$type", Value: "null"}}},
+		},
+		{
+			name: "should use $type with multiple types",
+			qs:   "filter[age:type]=int,long",
+			want: bson.M{"age": bson.D{primitive.E{Key: "$type", Value: bson.A{"int", "long"}}}},
+		},
+		{
+			name: "should use a bitmask for bitwise operators",
+			qs:   "filter[perms:bitsAllSet]=0x05",
+			want: bson.M{"perms": bson.D{primitive.E{Key: "$bitsAllSet", Value: int64(5)}}},
+		},
+		{
+			name: "should use positions for bitwise operators with multiple values",
+			qs:   "filter[perms:bitsAnyClear]=0,2",
+			want: bson.M{"perms": bson.D{primitive.E{Key: "$bitsAnyClear", Value: bson.A{int32(0), int32(2)}}}},
+		},
+		{
+			name: "should use $mod with a divisor and remainder",
+			qs:   "filter[shard:mod]=4,1",
+			want: bson.M{"shard": bson.D{primitive.E{Key: "$mod", Value: bson.A{int64(4), int64(1)}}}},
+		},
+		{
+			name:    "should reject bitwise operators for fields that are not integers",
+			qs:      "filter[name:bitsAnySet]=1",
+			wantErr: true,
+		},
+		{
+			name:    "should reject negative bit positions",
+			qs:      "filter[perms:bitsAllClear]=1,-2",
+			wantErr: true,
+		},
+		{
+			name:    "should reject $mod without a remainder",
+			qs:      "filter[shard:mod]=4",
+			wantErr: true,
+		},
+		{
+			name:    "should reject invalid types",
+			qs:      "filter[age:type]=integer",
+			wantErr: true,
+		},
+		{
+			name:    "should reject invalid boolean values",
+			qs:      "filter[name:exists]=yes",
+			wantErr: true,
+		},
+		{
+			name:    "should reject modifiers for fields that do not exist",
+			qs:      "filter[unknown:exists]=true",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := QueryBuilder{
+				collection: "test",
+				fieldTypes: map[string]string{
+					"age":   "int",
+					"name":  "string",
+					"owner": "object",
+					"perms": "long",
+					"shard": "int",
+				},
+				strictValidation: true,
+			}
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			got, err := qb.Filter(qo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryBuilder.Filter() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryBuilder.Filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package querybuilder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FieldPolicy returns the field access rules that apply to the caller
+// identified by the provided context (i.e. using roles that authentication
+// middleware has stored in the context)
+type FieldPolicy func(ctx context.Context) FieldAccess
+
+// FieldAccess describes the fields and operators a caller is not permitted to
+// use. Field names are public names (see SetFieldAliases) and apply to any
+// sub-fields as well. Keyword search (see SetTextSearch) is not subject to the
+// policy because $text matches the text index rather than individual fields,
+// so hidden fields should not be included in the text index.
+type FieldAccess struct {
+	// HiddenFields may not be filtered or sorted on and are always excluded
+	// from projections so that they never leave the database
+	HiddenFields []string
+
+	// DeniedOperators lists the operators (i.e. $regex, $ne, $in) that may not
+	// be used when filtering on a field ($eq is used for simple equality)
+	DeniedOperators map[string][]string
+}
+
+// SetFieldPolicy configures a policy that is consulted by FilterContext and
+// FindOptionsContext to determine which fields and operators the caller may
+// use. Clauses, sorts and projections that reference fields the caller is not
+// permitted to use are silently removed, unless strict validation is enabled
+// in which case an error is returned.
+func (qb *QueryBuilder) SetFieldPolicy(policy FieldPolicy) *QueryBuilder {
+	qb.fieldPolicy = policy
+
+	return qb
+}
+
+func (qb QueryBuilder) fieldAccess(ctx context.Context) *FieldAccess {
+	if qb.fieldPolicy == nil {
+		return nil
+	}
+
+	access := qb.fieldPolicy(ctx)
+	return &access
+}
+
+// checkFieldAccess determines whether the stored field path may be used by the
+// caller... when strict validation is enabled, an error is returned instead
+// of false
+func (qb QueryBuilder) checkFieldAccess(access *FieldAccess, public string, stored string) (bool, error) {
+	if access == nil {
+		return true, nil
+	}
+
+	for _, hidden := range access.HiddenFields {
+		if pathsOverlap(stored, qb.storedField(hidden)) {
+			return qb.denyAccess("field %s is not accessible in collection %s", public, qb.collection)
+		}
+	}
+
+	return true, nil
+}
+
+// checkFilterAccess determines whether each of the field paths and operators
+// within the filter conditions may be used by the caller
+func (qb QueryBuilder) checkFilterAccess(access *FieldAccess, public string, nodes []Node) (bool, error) {
+	if access == nil || len(nodes) == 0 {
+		return true, nil
+	}
+
+	paths := map[string][]string{}
+	for _, n := range nodes {
+		collectNodeOperators("", n, paths)
+	}
+
+	for path, operators := range paths {
+		// the fields of an $elemMatch are checked individually so that hidden
+		// sub-fields of the array do not prevent matching on the others
+		if !onlyElemMatch(operators) {
+			if allowed, err := qb.checkFieldAccess(access, public, path); !allowed {
+				return allowed, err
+			}
+		}
+
+		for field, denied := range access.DeniedOperators {
+			if !pathsOverlap(path, qb.storedField(field)) {
+				continue
+			}
+
+			for _, operator := range operators {
+				for _, d := range denied {
+					if operator == d {
+						return qb.denyAccess("operator %s is not permitted for field %s in collection %s", operator, public, qb.collection)
+					}
+				}
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// restrictProjection ensures hidden fields are excluded from the projection...
+// when the projection includes fields, hidden fields are removed from it,
+// otherwise hidden fields are explicitly excluded
+func (qb QueryBuilder) restrictProjection(access *FieldAccess, prj map[string]int) (map[string]int, error) {
+	if access == nil || len(access.HiddenFields) == 0 {
+		return prj, nil
+	}
+
+	// remove included fields that would return a hidden field
+	for _, hidden := range access.HiddenFields {
+		hidden = qb.storedField(hidden)
+		for field, val := range prj {
+			if val == 1 && pathsOverlap(field, hidden) {
+				if qb.strictValidation {
+					return nil, fmt.Errorf("field %s is not accessible in collection %s", qb.publicField(field), qb.collection)
+				}
+
+				delete(prj, field)
+			}
+		}
+	}
+
+	// when fields are still included, anything hidden is already excluded
+	for _, val := range prj {
+		if val == 1 {
+			return prj, nil
+		}
+	}
+
+	for _, hidden := range access.HiddenFields {
+		hidden = qb.storedField(hidden)
+
+		excluded := false
+		for field := range prj {
+			// an excluded parent already hides the field
+			if field == hidden || strings.HasPrefix(hidden, field+".") {
+				excluded = true
+				break
+			}
+
+			// an excluded child would collide with the hidden path
+			if strings.HasPrefix(field, hidden+".") {
+				delete(prj, field)
+			}
+		}
+
+		if !excluded {
+			prj[hidden] = 0
+		}
+	}
+
+	return prj, nil
+}
+
+func (qb QueryBuilder) denyAccess(format string, a ...interface{}) (bool, error) {
+	if qb.strictValidation {
+		return false, fmt.Errorf(format, a...)
+	}
+
+	return false, nil
+}
+
+// collectNodeOperators walks the conditions of a filter and records the
+// operators that are applied to each field path
+func collectNodeOperators(prefix string, node Node, paths map[string][]string) {
+	switch node := node.(type) {
+	case Group:
+		for _, n := range node.Nodes {
+			collectNodeOperators(prefix, n, paths)
+		}
+	case Condition:
+		switch {
+		case node.Operator == "$expr":
+			collectExprFields(node.Value, paths)
+		case node.Field == "":
+			// operators that are not applied to a field
+			return
+		default:
+			path := prefix + node.Field
+			paths[path] = append(paths[path], node.Operator)
+
+			// descend into sub-document conditions of arrays
+			if em, ok := node.Value.(Node); ok && node.Operator == "$elemMatch" {
+				collectNodeOperators(path+".", em, paths)
+			}
+		}
+	}
+}
+
+// collectExprFields records the fields referenced (i.e. "$startDate") within
+// an aggregation expression
+func collectExprFields(expr interface{}, paths map[string][]string) {
+	switch expr := expr.(type) {
+	case string:
+		if strings.HasPrefix(expr, "$") && !strings.HasPrefix(expr, "$$") {
+			path := strings.TrimPrefix(expr, "$")
+			paths[path] = append(paths[path], "$expr")
+		}
+	case bson.M:
+		for _, v := range expr {
+			collectExprFields(v, paths)
+		}
+	case bson.D:
+		for _, e := range expr {
+			collectExprFields(e.Value, paths)
+		}
+	case bson.A:
+		for _, v := range expr {
+			collectExprFields(v, paths)
+		}
+	}
+}
+
+func onlyElemMatch(operators []string) bool {
+	for _, operator := range operators {
+		if operator != "$elemMatch" {
+			return false
+		}
+	}
+
+	return len(operators) > 0
+}
+
+// pathsOverlap returns true when the paths are the same or when one of the
+// paths is a sub-field of the other
+func pathsOverlap(a string, b string) bool {
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
@@ -0,0 +1,209 @@
+package querybuilder
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type roleKey struct{}
+
+func testFieldPolicy(ctx context.Context) FieldAccess {
+	if role, _ := ctx.Value(roleKey{}).(string); role == "admin" {
+		return FieldAccess{}
+	}
+
+	return FieldAccess{
+		HiddenFields: []string{"salary", "identity.ssn", "items.salary"},
+		DeniedOperators: map[string][]string{
+			"name":       {"$regex"},
+			"owner":      {"$regex"},
+			"items.name": {"$regex"},
+		},
+	}
+}
+
+func TestQueryBuilder_SetFieldPolicy(t *testing.T) {
+	fieldTypes := map[string]string{
+		"name":         "string",
+		"salary":       "int",
+		"identity":     "object",
+		"identity.ssn": "string",
+		"owner":        "object",
+		"owner.name":   "string",
+		"items":        "array",
+		"items.name":   "string",
+		"items.salary": "int",
+	}
+
+	tests := []struct {
+		name             string
+		role             string
+		strictValidation bool
+		qs               string
+		wantFilter       bson.M
+		wantSort         interface{}
+		wantProjection   interface{}
+		wantErr          bool
+	}{
+		{
+			name: "should not restrict callers permitted to use all fields",
+			role: "admin",
+			qs:   "filter[salary]=>100&filter[name]=*bob*&sort=salary",
+			wantFilter: bson.M{
+				"salary": bson.D{primitive.E{Key: "$gt", Value: int32(100)}},
+				"name":   primitive.Regex{Pattern: "bob", Options: "im"},
+			},
+			wantSort: bson.D{{Key: "salary", Value: 1}},
+		},
+		{
+			name:       "should strip hidden fields and denied operators",
+			qs:         "filter[salary]=>100&filter[name]=*bob*&filter[identity]=ssn&sort=salary",
+			wantFilter: bson.M{},
+			wantProjection: map[string]int{
+				"salary":       0,
+				"identity.ssn": 0,
+				"items.salary": 0,
+			},
+		},
+		{
+			name:       "should permit operators that are not denied",
+			qs:         "filter[name]=bob&fields=name,identity",
+			wantFilter: bson.M{"name": "bob"},
+			wantProjection: map[string]int{
+				"name": 1,
+			},
+		},
+		{
+			name:       "should strip denied operators on sub-fields",
+			qs:         "filter[owner.name]=*bob*",
+			wantFilter: bson.M{},
+			wantProjection: map[string]int{
+				"salary":       0,
+				"identity.ssn": 0,
+				"items.salary": 0,
+			},
+		},
+		{
+			name:       "should permit operators that are not denied on sub-fields",
+			qs:         "filter[owner.name]=bob",
+			wantFilter: bson.M{"owner.name": "bob"},
+			wantProjection: map[string]int{
+				"salary":       0,
+				"identity.ssn": 0,
+				"items.salary": 0,
+			},
+		},
+		{
+			name:             "should reject denied operators on sub-fields with strict validation",
+			strictValidation: true,
+			qs:               "filter[owner.name]=bob*",
+			wantErr:          true,
+		},
+		{
+			name:       "should strip denied operators within element matches",
+			qs:         "filter[items.[*].name]=*bob*&filter[items.name]=[]*bob*",
+			wantFilter: bson.M{},
+			wantProjection: map[string]int{
+				"salary":       0,
+				"identity.ssn": 0,
+				"items.salary": 0,
+			},
+		},
+		{
+			name: "should permit operators that are not denied within element matches",
+			qs:   "filter[items.[*].name]=bob",
+			wantFilter: bson.M{
+				"items": bson.D{{Key: "$elemMatch", Value: bson.M{"name": "bob"}}},
+			},
+			wantProjection: map[string]int{
+				"salary":       0,
+				"identity.ssn": 0,
+				"items.salary": 0,
+			},
+		},
+		{
+			name:       "should strip hidden sub-fields within element matches",
+			qs:         "filter[items.[*].salary]=>100",
+			wantFilter: bson.M{},
+			wantProjection: map[string]int{
+				"salary":       0,
+				"identity.ssn": 0,
+				"items.salary": 0,
+			},
+		},
+		{
+			name:             "should reject hidden sub-fields within element matches with strict validation",
+			strictValidation: true,
+			qs:               "filter[items.[*].salary]=>100",
+			wantErr:          true,
+		},
+		{
+			name:             "should reject denied operators within element matches with strict validation",
+			strictValidation: true,
+			qs:               "filter[items.name]=[]*bob*",
+			wantErr:          true,
+		},
+		{
+			name:             "should reject hidden fields with strict validation",
+			strictValidation: true,
+			qs:               "filter[salary]=>100",
+			wantErr:          true,
+		},
+		{
+			name:             "should reject denied operators with strict validation",
+			strictValidation: true,
+			qs:               "filter[name]=bob*",
+			wantErr:          true,
+		},
+		{
+			name:             "should reject projection of hidden fields with strict validation",
+			strictValidation: true,
+			qs:               "fields=identity",
+			wantErr:          true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := (&QueryBuilder{
+				collection:       "test",
+				fieldTypes:       fieldTypes,
+				strictValidation: tt.strictValidation,
+			}).SetFieldPolicy(testFieldPolicy)
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			ctx := context.WithValue(context.Background(), roleKey{}, tt.role)
+			f, err := qb.FilterContext(ctx, qo)
+			if err == nil {
+				fo, ferr := qb.FindOptionsContext(ctx, qo)
+				if ferr == nil {
+					if !reflect.DeepEqual(fo.Sort, tt.wantSort) {
+						t.Errorf("QueryBuilder.FindOptionsContext() sort = %v, want %v", fo.Sort, tt.wantSort)
+					}
+					if !reflect.DeepEqual(fo.Projection, tt.wantProjection) {
+						t.Errorf("QueryBuilder.FindOptionsContext() projection = %v, want %v", fo.Projection, tt.wantProjection)
+					}
+				}
+				err = ferr
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryBuilder error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(f, tt.wantFilter) {
+				t.Errorf("QueryBuilder.FilterContext() = %v, want %v", f, tt.wantFilter)
+			}
+		})
+	}
+}
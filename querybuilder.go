@@ -1,13 +1,15 @@
 package querybuilder
 
 import (
+	"context"
 	"fmt"
-	"strconv"
+	"math"
+	"sort"
 	"strings"
 
 	queryoptions "go.jtlabs.io/query"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -15,17 +17,40 @@ import (
 // when used in combination with a QueryOptions struct that specifies filters,
 // pagination details, sorting instructions and field projection details.
 type QueryBuilder struct {
+	arrayFields      map[string]bool
+	boolAliases      map[string]bool
+	collation        *options.Collation
 	collection       string
+	defaultSort      []string
+	distanceField    string
+	fieldAliases     map[string]string
+	fieldCollations  map[string]*options.Collation
+	fieldLabels      map[string]string
+	fieldPolicy      FieldPolicy
 	fieldTypes       map[string]string
+	geoIndexes       map[string]string
+	limits           Limits
+	logger           Logger
+	matchStrength    int
+	messages         map[string]string
+	pagination       Pagination
+	rewriteRules     []RewriteRule
+	scopes           []Scope
+	sortTiebreaker   string
 	strictValidation bool
+	textSearch       *TextSearch
+	timeZone         string
 }
 
 // NewQueryBuilder returns a new instance of a QueryBuilder object for constructing
 // filters and options suitable for use with Mongo driver Find methods
 func NewQueryBuilder(collection string, schema bson.M, strictValidation ...bool) *QueryBuilder {
 	qb := QueryBuilder{
+		arrayFields:      map[string]bool{},
 		collection:       collection,
+		fieldLabels:      map[string]string{},
 		fieldTypes:       map[string]string{},
+		geoIndexes:       map[string]string{},
 		strictValidation: false,
 	}
 
@@ -42,29 +67,85 @@ func NewQueryBuilder(collection string, schema bson.M, strictValidation ...bool)
 	return &qb
 }
 
+// SetFieldAliases configures a map of public field names (as exposed by an API)
+// to the paths where the values are stored within the collection. Filter, sort
+// and projection fields are translated from public names to stored paths, and
+// an alias applies to any sub-fields as well (i.e. an alias of owner to
+// ownerInfo translates owner.name to ownerInfo.name). When strict validation is
+// enabled, stored paths that have a public alias are not accepted and errors
+// report the public name of the field.
+func (qb *QueryBuilder) SetFieldAliases(aliases map[string]string) *QueryBuilder {
+	qb.fieldAliases = map[string]string{}
+	for public, stored := range aliases {
+		qb.fieldAliases[public] = stored
+	}
+
+	return qb
+}
+
+// SetBoolAliases configures additional (case-insensitive) values that are
+// accepted for bool fields, i.e. map[string]bool{"yes": true, "no": false}...
+// the values accepted by strconv.ParseBool (true, false, 1, 0, etc.) are
+// always accepted. Filter returns an error for any other value (i.e. maybe),
+// regardless of strict validation.
+func (qb *QueryBuilder) SetBoolAliases(aliases map[string]bool) *QueryBuilder {
+	qb.boolAliases = map[string]bool{}
+	for alias, value := range aliases {
+		qb.boolAliases[strings.ToLower(alias)] = value
+	}
+
+	return qb
+}
+
+// Pagination configures the default and maximum size of pages of results and
+// whether page numbers (provided as page[page] or page[number] along with
+// page[size]) begin at 0 or 1
+type Pagination struct {
+	// DefaultSize is applied when neither page[limit] nor page[size] is provided
+	DefaultSize int
+
+	// MaxSize is the maximum page limit or size... larger values are clamped to
+	// MaxSize unless strict validation is enabled (in which case an error is
+	// returned)
+	MaxSize int
+
+	// OneBased indicates the first page is page 1 rather than page 0
+	OneBased bool
+}
+
+// SetPagination configures the pagination defaults and bounds for FindOptions
+// built by the QueryBuilder. Values that are out of range (i.e. negative
+// offsets) are clamped unless strict validation is enabled, in which case an
+// error is returned.
+func (qb *QueryBuilder) SetPagination(pagination Pagination) *QueryBuilder {
+	qb.pagination = pagination
+
+	return qb
+}
+
 // Filter builds a suitable bson document to send to any of the find methods
 // exposed by the Mongo driver. This method can validate the provided query
 // options against the schema that was used to build the QueryBuilder instance
 // when the QueryBuilder has strict validation enabled.
 //
 // The supported bson types for filter/search are:
-// * array (strings only and not with $in operator unless sub items are strings)
+// * array (items of any supported type, compared using the type of the items)
 // * bool
 // * date
 // * decimal
 // * double
+// * geo (fields configured with SetGeoIndex or a geoIndex schema annotation)
 // * int
 // * long
+// * null (using the null keyword, i.e. filter[name]=null)
 // * object (field detection)
 // * string
 // * timestamp
 //
 // The non-supported bson types for filter/search at this time
 // * object (actual object comparison... only fields within the object are supported)
-// * array (non string data)
 // * binData
 // * objectId
-// * null
 // * regex
 // * dbPointer
 // * javascript
@@ -73,10 +154,80 @@ func NewQueryBuilder(collection string, schema bson.M, strictValidation ...bool)
 // * minKey
 // * maxKey
 func (qb QueryBuilder) Filter(qo queryoptions.Options) (bson.M, error) {
-	filter := bson.M{}
+	return qb.FilterContext(context.Background(), qo)
+}
+
+// FilterContext builds a filter in the same manner as Filter, applying any
+// field policy configured for the QueryBuilder to the caller identified by
+// the provided context
+func (qb QueryBuilder) FilterContext(ctx context.Context, qo queryoptions.Options) (bson.M, error) {
+	node, err := qb.rewriteContext(ctx, qo)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := Compile(node)
+	if err := qb.checkClauseLimits(filter); err != nil {
+		return nil, err
+	}
+
+	// always apply mandatory scopes
+	if filter, err = qb.applyScopes(ctx, filter); err != nil {
+		return nil, err
+	}
+
+	qb.logf("querybuilder: %s filter %s", qb.collection, renderShell(filter))
+
+	return filter, nil
+}
+
+// Parse parses the filter of the query options into an AST, validating each
+// field against the schema (when strict validation is enabled) and the limits
+// configured for the QueryBuilder
+func (qb QueryBuilder) Parse(qo queryoptions.Options) (Node, error) {
+	return qb.ParseContext(context.Background(), qo)
+}
+
+// ParseContext parses the filter of the query options into an AST in the same
+// manner as Parse, applying any field policy configured for the QueryBuilder
+// to the caller identified by the provided context
+func (qb QueryBuilder) ParseContext(ctx context.Context, qo queryoptions.Options) (Node, error) {
+	root := Group{Operator: "$and"}
+	or := Group{Operator: "$or"}
+	access := qb.fieldAccess(ctx)
+
+	// ensure insensitive matching is configured with a usable strength
+	if err := qb.checkMatchStrength(); err != nil {
+		return nil, err
+	}
+
+	// ensure the filter does not exceed configured limits
+	if err := qb.checkFilterLimits(qo.Filter); err != nil {
+		return nil, err
+	}
 
 	if len(qo.Filter) > 0 {
-		for field, values := range qo.Filter {
+		// parse fields in a deterministic order
+		fields := make([]string, 0, len(qo.Filter))
+		for field := range qo.Filter {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			values := qo.Filter[field]
+
+			// handle keyword search
+			if qb.isTextSearchFilter(field) {
+				appendNodes(&root, &or, []Node{qb.textSearchFilter(values)})
+				continue
+			}
+
+			// handle field modifiers (i.e. tags:size)
+			var modifier string
+			field, modifier = splitFieldModifier(field)
+			public := field
+
 			// handle array fields
 			fiendNameWithNoIdx := strings.Split(field, "[]")[0]
 
@@ -86,158 +237,257 @@ func (qb QueryBuilder) Filter(qo queryoptions.Options) (bson.M, error) {
 				//elemMatchField = true
 			}
 
-			var bsonType string
+			// handle positions within array fields (i.e. tags.0)
+			fiendNameWithNoIdx = qb.trimPositions(fiendNameWithNoIdx)
+
+			// translate public field names to stored paths
+			storedNameWithNoIdx := qb.storedField(fiendNameWithNoIdx)
+			field = qb.storedField(field)
 
 			// lookup the field
-			if bt, ok := qb.fieldTypes[fiendNameWithNoIdx]; ok {
-				bsonType = bt
+			bsonType, err := qb.lookupField(fiendNameWithNoIdx, storedNameWithNoIdx)
+			if err != nil {
+				return nil, err
 			}
 
-			// check for strict field validation
-			if bsonType == "" && qb.strictValidation {
-				return nil, fmt.Errorf("field %s does not exist in collection %s", fiendNameWithNoIdx, qb.collection)
+			field = strings.ReplaceAll(field, "[]", ".")
+
+			// handle geo fields (regardless of bson type)
+			geoIndex, ok := qb.geoIndex(storedNameWithNoIdx, bsonType)
+			if ok {
+				bsonType = "geo"
 			}
 
-			field = strings.ReplaceAll(field, "[]", ".")
+			// values with a {} prefix must all be present in array fields
+			if modifier == "" && qb.isArrayField(storedNameWithNoIdx) && isAllFilter(values) {
+				modifier = "all"
+			}
 
-			switch bsonType {
-			case "array":
-				f := detectStringComparisonOperator(field, values, bsonType)
-				filter = combine(filter, f)
-			case "bool":
-				for _, value := range values {
-					usedNe := false
-					if strings.HasPrefix(value, "-") {
-						usedNe = true
-						value = strings.TrimPrefix(value, "-")
-					}
+			var nodes []Node
+			if modifier != "" {
+				if nodes, err = qb.detectModifierOperator(fiendNameWithNoIdx, field, modifier, values, bsonType); err != nil {
+					return nil, err
+				}
+			} else if prefix, other, ok := qb.fieldReference(values); ok {
+				if nodes, err = qb.detectFieldComparison(fiendNameWithNoIdx, field, bsonType, prefix, other); err != nil {
+					return nil, err
+				}
+			} else if parent, child, childValues, ok := splitElemMatch(field, values); ok {
+				// conditions on sub-documents within an array are matched using
+				// the type of the child field and bound to the same element
+				childPath := strings.Replace(public, ".[*].", ".", 1)
+				childType, err := qb.lookupField(childPath, fmt.Sprintf("%s.%s", parent, child))
+				if err != nil {
+					return nil, err
+				}
 
-					bv, _ := strconv.ParseBool(value)
+				if nodes, err = qb.detectComparisonOperator(childPath, child, childValues, childType, ""); err != nil {
+					return nil, err
+				}
 
-					var f primitive.M
-					if usedNe {
-						f = primitive.M{field: primitive.M{
-							"$ne": bv,
-						}}
-					} else {
-						f = primitive.M{field: bv}
-					}
-					filter = combine(filter, f)
+				if len(nodes) > 0 {
+					nodes = []Node{Condition{Field: parent, Operator: "$elemMatch", Value: Group{Operator: "$and", Nodes: nodes}}}
 				}
-			case "date":
-				f := detectDateComparisonOperator(field, values)
-				filter = combine(filter, f)
-			case "decimal":
-				f := detectNumericComparisonOperator(field, values, bsonType)
-				filter = combine(filter, f)
-			case "double":
-				f := detectNumericComparisonOperator(field, values, bsonType)
-				filter = combine(filter, f)
-			case "int":
-				f := detectNumericComparisonOperator(field, values, bsonType)
-				filter = combine(filter, f)
-			case "long":
-				f := detectNumericComparisonOperator(field, values, bsonType)
-				filter = combine(filter, f)
-			case "object":
-				f := detectStringComparisonOperator(field, values, bsonType)
-				filter = combine(filter, f)
-			case "string":
-				f := detectStringComparisonOperator(field, values, bsonType)
-				filter = combine(filter, f)
-			case "timestamp":
-				// handle just like dates
-				f := detectDateComparisonOperator(field, values)
-				filter = combine(filter, f)
-			case "geo":
-				f := detectGeoComparisonOperator(field, values)
-				filter = combine(filter, f)
+			} else if nodes, err = qb.detectComparisonOperator(fiendNameWithNoIdx, field, values, bsonType, geoIndex); err != nil {
+				return nil, err
+			}
+
+			// ensure the caller is permitted to filter with the conditions
+			allowed, err := qb.checkFilterAccess(access, fiendNameWithNoIdx, nodes)
+			if err != nil {
+				return nil, err
+			}
+
+			if allowed {
+				appendNodes(&root, &or, nodes)
 			}
 		}
 	}
 
-	return filter, nil
+	if len(or.Nodes) > 0 {
+		root.Nodes = append(root.Nodes, or)
+	}
+
+	return root, nil
 }
 
-func detectGeoComparisonOperator(field string, values []string) bson.M {
-	switch len(values) {
-	case 5:
-		return processBoxOperator(field, values)
-	case 3:
-		lat, err := strconv.ParseFloat(values[0], 64)
-		if err != nil {
-			panic("incorrect value: part 1 is not float")
+// detectComparisonOperator builds the conditions for the values of a filter
+// field using the operators appropriate to the bson type of the field
+func (qb QueryBuilder) detectComparisonOperator(name string, field string, values []string, bsonType string, geoIndex string) ([]Node, error) {
+	var f []Node
+	switch bsonType {
+	case "array":
+		f = detectStringComparisonOperator(field, values, bsonType, qb.matchStrength > 0)
+	case "bool":
+		var err error
+		if f, err = detectBoolComparisonOperator(field, values, qb.boolAliases); err != nil {
+			return nil, err
 		}
-		lon, err := strconv.ParseFloat(values[1], 64)
-		if err != nil {
-			panic("incorrect value: part 2 is not float")
+	case "date":
+		var err error
+		if f, err = detectDateComparisonOperator(field, values); err != nil {
+			return nil, err
 		}
-		radius, err := strconv.ParseFloat(values[2], 64)
-		if err != nil {
-			panic("incorrect value: part 3 is not float")
+	case "decimal":
+		f = detectNumericComparisonOperator(field, values, bsonType)
+	case "double":
+		f = detectNumericComparisonOperator(field, values, bsonType)
+	case "int":
+		f = detectNumericComparisonOperator(field, values, bsonType)
+	case "long":
+		f = detectNumericComparisonOperator(field, values, bsonType)
+	case "object":
+		f = detectStringComparisonOperator(field, values, bsonType, qb.matchStrength > 0)
+	case "string":
+		f = detectStringComparisonOperator(field, values, bsonType, qb.matchStrength > 0)
+	case "timestamp":
+		// handle just like dates
+		var err error
+		if f, err = detectDateComparisonOperator(field, values); err != nil {
+			return nil, err
+		}
+	case "geo":
+		var err error
+		if f, err = detectGeoComparisonOperator(field, values, geoIndex); err != nil {
+			return nil, fmt.Errorf("invalid geo filter for field %s: %w", name, err)
 		}
-
-		return bson.M{field: bson.M{
-			"$nearSphere": bson.M{
-				"$geometry": bson.M{
-					"type":        "Point",
-					"coordinates": []float64{lat, lon},
-				},
-				"$maxDistance": radius,
-			}}}
-	default:
-		panic("incorrect value: not 3 or 4 val")
 	}
+
+	return f, nil
 }
 
-func processBoxOperator(field string, values []string) bson.M {
-	lat1, err := strconv.ParseFloat(values[0], 64)
-	if err != nil {
-		panic("incorrect value: part 1 is not float")
-	}
-	lon1, err := strconv.ParseFloat(values[1], 64)
-	if err != nil {
-		panic("incorrect value: part 2 is not float")
+// splitElemMatch determines whether the filter field refers to a field of the
+// sub-documents within an array (either using parent.[*].child or by prefixing
+// values with []) and returns the parent and child fields when it does
+func splitElemMatch(field string, values []string) (string, string, []string, bool) {
+	if strings.Contains(field, ".[*].") {
+		split := strings.SplitN(field, ".[*].", 2)
+		return split[0], split[1], values, true
 	}
-	lat2, err := strconv.ParseFloat(values[2], 64)
-	if err != nil {
-		panic("incorrect value: part 3 is not float")
+
+	elemMatch := false
+	childValues := make([]string, len(values))
+	for i, value := range values {
+		if len(value) > 2 && value[0:2] == "[]" {
+			elemMatch = true
+			value = value[2:]
+		}
+
+		// handle nil keyword
+		if value == "nil" {
+			value = "null"
+		}
+
+		childValues[i] = value
 	}
-	lon2, err := strconv.ParseFloat(values[3], 64)
-	if err != nil {
-		panic("incorrect value: part 4 is not float")
+
+	idx := strings.LastIndex(field, ".")
+	if !elemMatch || idx < 0 {
+		return "", "", values, false
 	}
 
-	return bson.M{field: bson.M{
-		"$geoWithin": bson.M{
-			"$box": bson.A{
-				[]float64{lat1, lon1},
-				[]float64{lat2, lon2},
-			},
-		}}}
+	return field[:idx], field[idx+1:], childValues, true
 }
 
 // FindOptions creates a mongo.FindOptions struct with pagination details, sorting,
 // and field projection instructions set as specified in the query options input
 func (qb QueryBuilder) FindOptions(qo queryoptions.Options) (*options.FindOptions, error) {
+	return qb.FindOptionsContext(context.Background(), qo)
+}
+
+// FindOptionsContext creates a mongo.FindOptions struct in the same manner as
+// FindOptions, applying any field policy configured for the QueryBuilder to the
+// caller identified by the provided context
+func (qb QueryBuilder) FindOptionsContext(ctx context.Context, qo queryoptions.Options) (*options.FindOptions, error) {
 	opts := options.Find()
+	access := qb.fieldAccess(ctx)
+
+	// ensure sorting and pagination do not exceed configured limits
+	if err := qb.checkOptionsLimits(qo); err != nil {
+		return nil, err
+	}
 
 	// determine pagination for the options
-	qb.setPaginationOptions(qo.Page, opts)
+	if err := qb.setPaginationOptions(qo.Page, opts); err != nil {
+		return nil, err
+	}
 
 	// determine projection for the options
-	if err := qb.setProjectionOptions(qo.Fields, opts); err != nil {
+	if err := qb.setProjectionOptions(qo.Fields, access, opts); err != nil {
 		return nil, err
 	}
 
 	// determine sorting for the options
-	if err := qb.setSortOptions(qo.Sort, opts); err != nil {
+	if err := qb.setSortOptions(qo.Sort, access, opts); err != nil {
 		return nil, err
 	}
 
+	// project the relevance of keyword search
+	qb.setTextScoreOptions(qo, opts)
+
+	qb.logf("querybuilder: %s options %s", qb.collection, renderFindOptions(opts))
+
 	return opts, nil
 }
 
+// Pipeline creates an aggregation pipeline with $match, $sort, $skip, $limit
+// and $project stages equivalent to the filter and options that Filter and
+// FindOptions build for the query options. When a geo near filter is provided,
+// a leading $geoNear stage (with the remaining filter as its query) replaces
+// the $match stage and the distance of each document is included in the
+// results (see SetDistanceField).
+func (qb QueryBuilder) Pipeline(qo queryoptions.Options) (mongo.Pipeline, error) {
+	return qb.PipelineContext(context.Background(), qo)
+}
+
+// PipelineContext creates an aggregation pipeline in the same manner as
+// Pipeline, applying any field policy and scopes configured for the
+// QueryBuilder to the caller identified by the provided context
+func (qb QueryBuilder) PipelineContext(ctx context.Context, qo queryoptions.Options) (mongo.Pipeline, error) {
+	filter, err := qb.FilterContext(ctx, qo)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := qb.FindOptionsContext(ctx, qo)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := mongo.Pipeline{}
+
+	// near filters become a leading $geoNear stage (which sorts by distance)
+	if stage, ok := qb.geoNearStage(filter); ok {
+		pipeline = append(pipeline, stage)
+		qb.includeDistanceField(opts)
+
+		// retain distance ordering unless a sort is provided
+		if len(qo.Sort) == 0 {
+			opts.Sort = nil
+		}
+	} else if len(filter) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: filter}})
+	}
+
+	if opts.Sort != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: opts.Sort}})
+	}
+
+	if opts.Skip != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: *opts.Skip}})
+	}
+
+	if opts.Limit != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: *opts.Limit}})
+	}
+
+	if opts.Projection != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: opts.Projection}})
+	}
+
+	return pipeline, nil
+}
+
 func (qb QueryBuilder) discoverFields(schema bson.M) {
 	// ensure fieldTypes is set
 	if qb.fieldTypes == nil {
@@ -270,7 +520,27 @@ func (qb QueryBuilder) iterateProperties(parentPrefix string, properties bson.M)
 					qb.fieldTypes[fmt.Sprintf("%s%s", parentPrefix, field)] = bsonType
 				}
 
+				// capture labels for descriptions (the title, or otherwise the
+				// description of the field)
+				if qb.fieldLabels != nil {
+					for _, key := range []string{"title", "description"} {
+						if label, ok := value[key].(string); ok && label != "" {
+							qb.fieldLabels[fmt.Sprintf("%s%s", parentPrefix, field)] = label
+							break
+						}
+					}
+				}
+
+				// capture geo index annotations (i.e. "geoIndex": "2dsphere")
+				if index, ok := value["geoIndex"].(string); ok && qb.geoIndexes != nil {
+					qb.geoIndexes[fmt.Sprintf("%s%s", parentPrefix, field)] = index
+				}
+
 				if bsonType == "array" {
+					if qb.arrayFields != nil {
+						qb.arrayFields[fmt.Sprintf("%s%s", parentPrefix, field)] = true
+					}
+
 					// look at "items" to get the bsonType
 					if items, ok := value["items"]; ok {
 						value = items.(bson.M)
@@ -308,75 +578,233 @@ func (qb QueryBuilder) iterateProperties(parentPrefix string, properties bson.M)
 	}
 }
 
-func (qb QueryBuilder) setPaginationOptions(pagination map[string]int, opts *options.FindOptions) {
-	// check for limit
-	if limit, ok := pagination["limit"]; ok {
-		opts.SetLimit(int64(limit))
+// lookupField returns the bson type of the stored field and, when strict
+// validation is enabled, returns an error (naming the public field) when the
+// field does not exist in the schema
+func (qb QueryBuilder) lookupField(public string, stored string) (string, error) {
+	bsonType, ok := qb.fieldTypes[stored]
 
-		// check for offset (once limit is set)
-		if offset, ok := pagination["offset"]; ok {
-			opts.SetSkip(int64(offset))
+	// stored paths that have been aliased are not public
+	if ok && len(qb.fieldAliases) > 0 && qb.publicField(stored) != public {
+		ok = false
+	}
+
+	// check for strict field validation
+	if !ok && qb.strictValidation {
+		return "", fmt.Errorf("field %s does not exist in collection %s", public, qb.collection)
+	}
+
+	return bsonType, nil
+}
+
+// publicField translates a stored path to the public field name using the
+// longest matching alias
+func (qb QueryBuilder) publicField(stored string) string {
+	for i := len(stored); i > 0; i-- {
+		if i < len(stored) && !isPathSeparator(stored[i]) {
+			continue
 		}
 
-		// check for skip (once limit is set)
-		if skip, ok := pagination["skip"]; ok {
-			opts.SetSkip(int64(skip))
+		for public, path := range qb.fieldAliases {
+			if path == stored[:i] {
+				return public + stored[i:]
+			}
 		}
 	}
 
-	// check for page and size
-	if size, ok := pagination["size"]; ok {
-		opts.SetLimit(int64(size))
+	return stored
+}
+
+// storedField translates a public field name to the stored path using the
+// longest matching alias
+func (qb QueryBuilder) storedField(public string) string {
+	if len(qb.fieldAliases) == 0 {
+		return public
+	}
+
+	for i := len(public); i > 0; i-- {
+		if i < len(public) && !isPathSeparator(public[i]) {
+			continue
+		}
 
-		// set skip (requires understanding of size)
-		if page, ok := pagination["page"]; ok {
-			opts.SetSkip(int64(page * size))
+		if path, ok := qb.fieldAliases[public[:i]]; ok {
+			return path + public[i:]
 		}
 	}
+
+	return public
 }
 
-func (qb QueryBuilder) setProjectionOptions(fields []string, opts *options.FindOptions) error {
-	// set field projections option
-	if len(fields) > 0 {
-		prj := map[string]int{}
-		for _, field := range fields {
-			val := 1
+func isPathSeparator(c byte) bool {
+	return c == '.' || c == '['
+}
 
-			// handle when the first char is a - (don't display field in result)
-			if field[0:1] == "-" {
-				field = field[1:]
-				val = 0
+func (qb QueryBuilder) setPaginationOptions(pagination map[string]int, opts *options.FindOptions) error {
+	// first page is 1 when pages are 1-based
+	firstPage := 0
+	if qb.pagination.OneBased {
+		firstPage = 1
+	}
+
+	// check for limit
+	if limit, ok := pagination["limit"]; ok {
+		limit, err := qb.pageSize("limit", limit)
+		if err != nil {
+			return err
+		}
+		opts.SetLimit(int64(limit))
+
+		// check for offset (once limit is set)
+		for _, key := range []string{"offset", "skip"} {
+			if offset, ok := pagination[key]; ok {
+				offset, err := qb.pageValue(key, offset, 0)
+				if err != nil {
+					return err
+				}
+				opts.SetSkip(int64(offset))
 			}
+		}
 
-			// handle scenarios where the first char is a + (redundant)
-			if field[0:1] == "+" {
-				field = field[1:]
+		return nil
+	}
+
+	// check for page and size (applying the default size, or otherwise the
+	// maximum size, when not provided)
+	size, ok := pagination["size"]
+	if !ok {
+		size = qb.pagination.DefaultSize
+		if size == 0 {
+			size = qb.maxPageSize()
+		}
+
+		if size == 0 {
+			return nil
+		}
+	}
+
+	size, err := qb.pageSize("size", size)
+	if err != nil {
+		return err
+	}
+	opts.SetLimit(int64(size))
+
+	// set skip (requires understanding of size)
+	for _, key := range []string{"page", "number"} {
+		if page, ok := pagination[key]; ok {
+			page, err := qb.pageValue(key, page, firstPage)
+			if err != nil {
+				return err
 			}
 
-			// lookup field in the fieldTypes dictionary if strictValidation is true
-			if qb.strictValidation {
-				field = strings.Split(field, "[]")[0]
-				if _, ok := qb.fieldTypes[field]; !ok {
-					// we have a problem
-					return fmt.Errorf("field %s does not exist in collection %s", field, qb.collection)
+			// ensure the number of documents skipped does not overflow
+			pages := int64(page - firstPage)
+			if size > 0 && pages > math.MaxInt64/int64(size) {
+				if qb.strictValidation {
+					return fmt.Errorf("page %s (%d) exceeds the maximum of %d", key, page, math.MaxInt64/int64(size)+int64(firstPage))
 				}
-				field = strings.ReplaceAll(field, "[]", ".")
+
+				pages = math.MaxInt64 / int64(size)
 			}
+			opts.SetSkip(pages * int64(size))
+		}
+	}
+
+	return nil
+}
+
+// pageSize ensures a page limit or size is within the maximum configured for
+// the QueryBuilder (0 is treated as unbounded)
+func (qb QueryBuilder) pageSize(key string, size int) (int, error) {
+	size, err := qb.pageValue(key, size, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	max := qb.maxPageSize()
+	if max > 0 && (size == 0 || size > max) {
+		if qb.strictValidation {
+			return 0, fmt.Errorf("%w: page %s (%d) exceeds the limit of %d", ErrQueryTooComplex, key, size, max)
+		}
+
+		size = max
+	}
+
+	return size, nil
+}
+
+// maxPageSize returns the smaller of Pagination.MaxSize and Limits.MaxPageSize
+// (0 when neither is configured)
+func (qb QueryBuilder) maxPageSize() int {
+	max := qb.pagination.MaxSize
+	if limit := qb.limits.MaxPageSize; limit > 0 && (max == 0 || limit < max) {
+		max = limit
+	}
+
+	return max
+}
+
+// pageValue ensures a pagination value is not less than the minimum, clamping
+// the value (or returning an error when strict validation is enabled)
+func (qb QueryBuilder) pageValue(key string, value int, min int) (int, error) {
+	if value < min {
+		if qb.strictValidation {
+			return 0, fmt.Errorf("page %s (%d) must be at least %d", key, value, min)
+		}
+
+		value = min
+	}
+
+	return value, nil
+}
+
+func (qb QueryBuilder) setProjectionOptions(fields []string, access *FieldAccess, opts *options.FindOptions) error {
+	// set field projections option
+	prj := map[string]int{}
+	for _, field := range fields {
+		val := 1
+
+		// handle when the first char is a - (don't display field in result)
+		if field[0:1] == "-" {
+			field = field[1:]
+			val = 0
+		}
 
-			// add the field to the project dictionary
-			prj[field] = val
+		// handle scenarios where the first char is a + (redundant)
+		if field[0:1] == "+" {
+			field = field[1:]
 		}
 
-		// add the projection to the FindOptions
-		if len(prj) > 0 {
-			opts.SetProjection(prj)
+		// lookup field in the fieldTypes dictionary if strictValidation is true
+		fiendNameWithNoIdx := strings.Split(field, "[]")[0]
+		if _, err := qb.lookupField(fiendNameWithNoIdx, qb.storedField(fiendNameWithNoIdx)); err != nil {
+			return err
 		}
+		field = strings.ReplaceAll(qb.storedField(field), "[]", ".")
+
+		// add the field to the project dictionary
+		prj[field] = val
+	}
+
+	// ensure hidden fields are never returned
+	prj, err := qb.restrictProjection(access, prj)
+	if err != nil {
+		return err
+	}
+
+	// add the projection to the FindOptions
+	if len(prj) > 0 {
+		opts.SetProjection(prj)
 	}
 
 	return nil
 }
 
-func (qb QueryBuilder) setSortOptions(fields []string, opts *options.FindOptions) error {
+func (qb QueryBuilder) setSortOptions(fields []string, access *FieldAccess, opts *options.FindOptions) error {
+	// apply the default sort when none is provided
+	if len(fields) == 0 {
+		fields = qb.defaultSort
+	}
+
 	if len(fields) > 0 {
 		sort := bson.D{}
 		for _, field := range fields {
@@ -391,20 +819,45 @@ func (qb QueryBuilder) setSortOptions(fields []string, opts *options.FindOptions
 				field = field[1:]
 			}
 
+			// sort by relevance of keyword search
+			if qb.isTextScoreSort(field) {
+				sort = append(sort, bson.E{Key: qb.textScoreField(), Value: textScore})
+				continue
+			}
+
 			// lookup field in the fieldTypes dictionary if strictValidation is true
-			if qb.strictValidation {
-				fiendNameWithNoIdx := strings.Split(field, "[]")[0]
-				if _, ok := qb.fieldTypes[fiendNameWithNoIdx]; !ok {
-					// we have a problem
-					return fmt.Errorf("field %s does not exist in collection %s", fiendNameWithNoIdx, qb.collection)
-				}
-				field = strings.ReplaceAll(field, "[]", ".")
+			fiendNameWithNoIdx := strings.Split(field, "[]")[0]
+			if _, err := qb.lookupField(fiendNameWithNoIdx, qb.storedField(fiendNameWithNoIdx)); err != nil {
+				return err
+			}
+			field = strings.ReplaceAll(qb.storedField(field), "[]", ".")
+
+			// ensure the caller is permitted to sort by the field
+			allowed, err := qb.checkFieldAccess(access, fiendNameWithNoIdx, field)
+			if err != nil {
+				return err
+			}
+
+			if !allowed {
+				continue
 			}
 
 			sort = append(sort, bson.E{Key: field, Value: val})
 		}
 
-		opts.SetSort(sort)
+		if len(sort) > 0 {
+			opts.SetSort(qb.appendSortTiebreaker(sort))
+		}
+	}
+
+	// apply a collation suitable for the sort and string matching
+	collation, err := qb.matchCollation(qb.sortCollation(opts.Sort))
+	if err != nil {
+		return err
+	}
+
+	if collation != nil {
+		opts.SetCollation(collation)
 	}
 
 	return nil
@@ -2,6 +2,7 @@ package querybuilder
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 	"testing"
 	"time"
@@ -213,6 +214,30 @@ func TestQueryBuilder_Filter(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name: "should error when a list of dates contains an invalid date",
+			fields: fields{
+				collection: "test",
+				fieldTypes: map[string]string{"created": "date"},
+			},
+			args: args{
+				qs: "filter[created]=foo,bar",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "should error when a list of dates mixes negated and included values",
+			fields: fields{
+				collection: "test",
+				fieldTypes: map[string]string{"created": "date"},
+			},
+			args: args{
+				qs: "filter[created]=-2021-01-01T00:00:00Z,2021-01-02T00:00:00Z",
+			},
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name: "should not error without strict validation and mismatched field",
 			fields: fields{
@@ -309,12 +334,10 @@ func TestQueryBuilder_Filter(t *testing.T) {
 				qs: "filter[aVal.iVal1]=[]1&filter[aVal.iVal2]=[]nil",
 			},
 			want: bson.M{
-				"aVal": bson.M{
-					"$elemMatch": bson.M{
-						"iVal1": 1,
-						"iVal2": nil,
-					},
-				},
+				"aVal": bson.D{{Key: "$elemMatch", Value: bson.M{
+					"iVal1": 1,
+					"iVal2": nil,
+				}}},
 			},
 			wantErr: false,
 		},
@@ -332,24 +355,39 @@ func TestQueryBuilder_Filter(t *testing.T) {
 				qs: "filter[aVal.[*].innerArray.iVal1]=-2020-01-01T12:00:00.000Z,-2020-01-02T12:00:00.000Z",
 			},
 			want: bson.M{
-				"aVal": bson.M{
-					"$elemMatch": bson.M{
-						"$or": bson.A{
-							bson.M{
-								"innerArray.iVal1": bson.M{
-									"$nin": bson.A{
-										time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC),
-										time.Date(2020, time.January, 2, 12, 0, 0, 0, time.UTC),
-									},
-								},
-							},
-							bson.M{
-								"innerArray.iVal1": nil,
-							},
+				"aVal": bson.D{{Key: "$elemMatch", Value: bson.M{
+					"innerArray.iVal1": bson.D{primitive.E{
+						Key: "$nin",
+						Value: bson.A{
+							time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC),
+							time.Date(2020, time.January, 2, 12, 0, 0, 0, time.UTC),
 						},
-					},
+					}},
+				}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "should properly handle $elemMatch operator using typed operators for each child field",
+			fields: fields{
+				collection: "test",
+				fieldTypes: map[string]string{
+					"items":       "array",
+					"items.name":  "string",
+					"items.qty":   "int",
+					"items.price": "double",
 				},
 			},
+			args: args{
+				qs: "filter[items.[*].name]=wid*&filter[items.[*].qty]=>=5&filter[items.price]=[]1.5,[]2.5",
+			},
+			want: bson.M{
+				"items": bson.D{{Key: "$elemMatch", Value: bson.M{
+					"name":  primitive.Regex{Pattern: "^wid", Options: "im"},
+					"qty":   bson.D{primitive.E{Key: "$gte", Value: int32(5)}},
+					"price": bson.D{primitive.E{Key: "$in", Value: bson.A{1.5, 2.5}}},
+				}}},
+			},
 			wantErr: false,
 		},
 		{
@@ -379,7 +417,7 @@ func TestQueryBuilder_Filter(t *testing.T) {
 			},
 			wantErr: false,
 		},
-		/*TODO fixme: {
+		{
 			name: "should properly handle $or operator for date and number",
 			fields: fields{
 				collection: "test",
@@ -396,10 +434,10 @@ func TestQueryBuilder_Filter(t *testing.T) {
 			want: bson.M{
 				"$or": bson.A{
 					bson.M{
-						"iVal1": bson.E{
+						"iVal1": bson.D{primitive.E{
 							Key:   "$gt",
 							Value: time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC),
-						},
+						}},
 					},
 					bson.M{
 						"iVal2": int32(100),
@@ -408,7 +446,7 @@ func TestQueryBuilder_Filter(t *testing.T) {
 				"iVal3": "test3",
 			},
 			wantErr: false,
-		},*/
+		},
 		{
 			name: "should properly handle $or operator for date and range of numbers",
 			fields: fields{
@@ -426,16 +464,16 @@ func TestQueryBuilder_Filter(t *testing.T) {
 			want: bson.M{
 				"$or": bson.A{
 					bson.M{
-						"iVal1": bson.E{
+						"iVal1": bson.D{primitive.E{
 							Key:   "$gt",
 							Value: time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC),
-						},
+						}},
 					},
 					bson.M{
-						"iVal2": bson.E{
+						"iVal2": bson.D{primitive.E{
 							Key:   "$ne",
 							Value: int32(100),
-						},
+						}},
 					},
 				},
 				"iVal3": "test3",
@@ -590,9 +628,10 @@ func TestQueryBuilder_Filter(t *testing.T) {
 			},
 			want: bson.M{
 				"bVal1": true,
-				"bVal2": primitive.M{
-					"$ne": false,
-				}},
+				"bVal2": bson.D{primitive.E{
+					Key:   "$ne",
+					Value: false,
+				}}},
 			wantErr: false,
 		},
 		{
@@ -1154,3 +1193,291 @@ func TestQueryBuilder_FindOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryBuilder_SetFieldAliases(t *testing.T) {
+	fieldTypes := map[string]string{
+		"created_ts":         "date",
+		"ownerInfo":          "object",
+		"ownerInfo.fullName": "string",
+		"status":             "string",
+	}
+	aliases := map[string]string{
+		"createdAt":  "created_ts",
+		"owner":      "ownerInfo",
+		"owner.name": "ownerInfo.fullName",
+	}
+
+	tests := []struct {
+		name             string
+		strictValidation bool
+		qs               string
+		wantFilter       bson.M
+		wantSort         bson.D
+		wantProjection   map[string]int
+		wantErr          string
+	}{
+		{
+			name: "should translate public names to stored paths",
+			qs:   "filter[owner.name]=alice&filter[status]=active&sort=-createdAt&fields=owner,-createdAt",
+			wantFilter: bson.M{
+				"ownerInfo.fullName": "alice",
+				"status":             "active",
+			},
+			wantSort:       bson.D{{Key: "created_ts", Value: -1}},
+			wantProjection: map[string]int{"ownerInfo": 1, "created_ts": 0},
+		},
+		{
+			name:             "should apply strict validation to public names",
+			strictValidation: true,
+			qs:               "filter[createdAt]=<2021-02-16T02:04:05.000Z",
+			wantFilter: bson.M{
+				"created_ts": bson.D{primitive.E{
+					Key:   "$lt",
+					Value: time.Date(2021, time.February, 16, 2, 4, 5, 0, time.UTC),
+				}},
+			},
+		},
+		{
+			name:             "should reject stored paths that have a public alias",
+			strictValidation: true,
+			qs:               "filter[created_ts]=2021-02-16T02:04:05.000Z",
+			wantErr:          "field created_ts does not exist in collection test",
+		},
+		{
+			name:             "should report public names in errors",
+			strictValidation: true,
+			qs:               "sort=owner.nickname",
+			wantErr:          "field owner.nickname does not exist in collection test",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := (&QueryBuilder{
+				collection:       "test",
+				fieldTypes:       fieldTypes,
+				strictValidation: tt.strictValidation,
+			}).SetFieldAliases(aliases)
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			f, err := qb.Filter(qo)
+			if err == nil {
+				var fo *options.FindOptions
+				fo, err = qb.FindOptions(qo)
+				if err == nil && tt.wantSort != nil && !reflect.DeepEqual(fo.Sort, tt.wantSort) {
+					t.Errorf("QueryBuilder.FindOptions() sort = %v, want %v", fo.Sort, tt.wantSort)
+				}
+				if err == nil && tt.wantProjection != nil && !reflect.DeepEqual(fo.Projection, tt.wantProjection) {
+					t.Errorf("QueryBuilder.FindOptions() projection = %v, want %v", fo.Projection, tt.wantProjection)
+				}
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("QueryBuilder error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("QueryBuilder error = %v", err)
+				return
+			}
+
+			if !reflect.DeepEqual(f, tt.wantFilter) && fmt.Sprintf("%+v", f) != fmt.Sprintf("%+v", tt.wantFilter) {
+				t.Errorf("QueryBuilder.Filter() = %v, want %v", f, tt.wantFilter)
+			}
+		})
+	}
+}
+
+func TestQueryBuilder_SetBoolAliases(t *testing.T) {
+	tests := []struct {
+		name             string
+		strictValidation bool
+		qs               string
+		want             bson.M
+		wantErr          bool
+	}{
+		{
+			name: "should use $in for multiple values",
+			qs:   "filter[active]=true,false",
+			want: bson.M{"active": bson.D{primitive.E{Key: "$in", Value: bson.A{true, false}}}},
+		},
+		{
+			name: "should accept configured aliases",
+			qs:   "filter[active]=YES",
+			want: bson.M{"active": true},
+		},
+		{
+			name: "should match null or missing values",
+			qs:   "filter[active]=no,null",
+			want: bson.M{"active": bson.D{primitive.E{Key: "$in", Value: bson.A{false, nil}}}},
+		},
+		{
+			name: "should use $nin for multiple negated values",
+			qs:   "filter[active]=-true,-null",
+			want: bson.M{"active": bson.D{primitive.E{Key: "$nin", Value: bson.A{true, nil}}}},
+		},
+		{
+			name:    "should reject values that are not booleans",
+			qs:      "filter[active]=maybe",
+			wantErr: true,
+		},
+		{
+			name:    "should reject lists containing values that are not booleans",
+			qs:      "filter[active]=maybe,1",
+			wantErr: true,
+		},
+		{
+			name:             "should reject values that are not booleans with strict validation",
+			strictValidation: true,
+			qs:               "filter[active]=maybe",
+			wantErr:          true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := (&QueryBuilder{
+				collection:       "test",
+				fieldTypes:       map[string]string{"active": "bool"},
+				strictValidation: tt.strictValidation,
+			}).SetBoolAliases(map[string]bool{"Yes": true, "No": false})
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			got, err := qb.Filter(qo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryBuilder.Filter() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryBuilder.Filter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryBuilder_SetPagination(t *testing.T) {
+	limit := func(v int64) *int64 { return &v }
+
+	tests := []struct {
+		name             string
+		pagination       Pagination
+		limits           Limits
+		strictValidation bool
+		page             map[string]int
+		wantLimit        *int64
+		wantSkip         *int64
+		wantErr          bool
+	}{
+		{
+			name:       "should apply default size when no page is provided",
+			pagination: Pagination{DefaultSize: 25},
+			wantLimit:  limit(25),
+		},
+		{
+			name:       "should apply default size to page number",
+			pagination: Pagination{DefaultSize: 25},
+			page:       map[string]int{"number": 2},
+			wantLimit:  limit(25),
+			wantSkip:   limit(50),
+		},
+		{
+			name:       "should support 1-based page numbers",
+			pagination: Pagination{OneBased: true},
+			page:       map[string]int{"number": 3, "size": 10},
+			wantLimit:  limit(10),
+			wantSkip:   limit(20),
+		},
+		{
+			name:       "should clamp limits that exceed the maximum",
+			pagination: Pagination{MaxSize: 100},
+			page:       map[string]int{"limit": 10000000, "offset": -5},
+			wantLimit:  limit(100),
+			wantSkip:   limit(0),
+		},
+		{
+			name:       "should clamp page numbers below the first page",
+			pagination: Pagination{OneBased: true},
+			page:       map[string]int{"page": 0, "size": 10},
+			wantLimit:  limit(10),
+			wantSkip:   limit(0),
+		},
+		{
+			name:       "should apply the maximum size when no page is provided",
+			pagination: Pagination{MaxSize: 100},
+			wantLimit:  limit(100),
+		},
+		{
+			name:       "should clamp limits to the smaller of the maximum sizes",
+			pagination: Pagination{MaxSize: 100},
+			limits:     Limits{MaxPageSize: 50},
+			page:       map[string]int{"limit": 80},
+			wantLimit:  limit(50),
+		},
+		{
+			name:       "should clamp page numbers that would overflow",
+			pagination: Pagination{OneBased: true},
+			page:       map[string]int{"number": math.MaxInt, "size": 10},
+			wantLimit:  limit(10),
+			wantSkip:   limit(math.MaxInt64 / 10 * 10),
+		},
+		{
+			name:             "should reject page numbers that would overflow with strict validation",
+			strictValidation: true,
+			page:             map[string]int{"number": math.MaxInt, "size": 10},
+			wantErr:          true,
+		},
+		{
+			name:             "should reject limits that exceed the maximum with strict validation",
+			pagination:       Pagination{MaxSize: 100},
+			strictValidation: true,
+			page:             map[string]int{"limit": 10000000},
+			wantErr:          true,
+		},
+		{
+			name:             "should reject page numbers below the first page with strict validation",
+			pagination:       Pagination{OneBased: true},
+			strictValidation: true,
+			page:             map[string]int{"number": 0, "size": 10},
+			wantErr:          true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := (&QueryBuilder{
+				collection:       "test",
+				fieldTypes:       map[string]string{},
+				strictValidation: tt.strictValidation,
+			}).SetPagination(tt.pagination).SetLimits(tt.limits)
+
+			got, err := qb.FindOptions(queryoptions.Options{Page: tt.page})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryBuilder.FindOptions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(got.Limit, tt.wantLimit) {
+				t.Errorf("QueryBuilder.FindOptions() limit = %v, want %v", got.Limit, tt.wantLimit)
+			}
+
+			if !reflect.DeepEqual(got.Skip, tt.wantSkip) {
+				t.Errorf("QueryBuilder.FindOptions() skip = %v, want %v", got.Skip, tt.wantSkip)
+			}
+		})
+	}
+}
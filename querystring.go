@@ -0,0 +1,146 @@
+package querybuilder
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	queryoptions "go.jtlabs.io/query"
+)
+
+var rePageParam = regexp.MustCompile(`^page\[(.+)\]$`)
+
+// Querystring serialises query options back into a canonical, URL encoded
+// querystring (i.e. for JSON:API links or saved searches) that parses to the
+// same options, and therefore builds the same filter and FindOptions... filter
+// and page parameters are ordered by name and fields are sorted, while the
+// order of sort fields and of the values of each filter is retained as it is
+// significant. Opaque cursor tokens (i.e. map[string]string{"after": token})
+// are serialised as page parameters along with the page parameters of the
+// query options, and can be retrieved again using ParseQuerystring.
+func Querystring(qo queryoptions.Options, cursors ...map[string]string) (string, error) {
+	params := []string{}
+
+	// filter[field]=value,value
+	fields := []string{}
+	for field := range qo.Filter {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		values, err := escapeValues("filter", field, qo.Filter[field])
+		if err != nil {
+			return "", err
+		}
+
+		params = append(params, fmt.Sprintf("filter[%s]=%s", url.QueryEscape(field), values))
+	}
+
+	// fields=name,name
+	if len(qo.Fields) > 0 {
+		projection := append([]string{}, qo.Fields...)
+		sort.Strings(projection)
+
+		values, err := escapeValues("fields", "", projection)
+		if err != nil {
+			return "", err
+		}
+
+		params = append(params, fmt.Sprintf("fields=%s", values))
+	}
+
+	// page[key]=n and page[key]=token
+	page := map[string]string{}
+	for key, n := range qo.Page {
+		page[key] = strconv.Itoa(n)
+	}
+
+	for _, c := range cursors {
+		for key, token := range c {
+			if _, ok := page[key]; ok {
+				return "", fmt.Errorf("invalid cursor for page[%s], the page parameter is already set", key)
+			}
+
+			page[key] = token
+		}
+	}
+
+	keys := []string{}
+	for key := range page {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		params = append(params, fmt.Sprintf("page[%s]=%s", url.QueryEscape(key), url.QueryEscape(page[key])))
+	}
+
+	// sort=-name,name
+	if len(qo.Sort) > 0 {
+		values, err := escapeValues("sort", "", qo.Sort)
+		if err != nil {
+			return "", err
+		}
+
+		params = append(params, fmt.Sprintf("sort=%s", values))
+	}
+
+	return strings.Join(params, "&"), nil
+}
+
+// ParseQuerystring parses a querystring built by Querystring into the query
+// options and the cursor tokens... page parameters that are not integers are
+// returned as cursor tokens rather than causing an error when the query
+// options are parsed, so tokens that are integers are returned as page
+// parameters of the query options instead
+func ParseQuerystring(qs string) (queryoptions.Options, map[string]string, error) {
+	cursors := map[string]string{}
+	terms := []string{}
+
+	for _, term := range strings.Split(qs, "&") {
+		kv := strings.SplitN(term, "=", 2)
+		if len(kv) == 2 {
+			key, kerr := url.QueryUnescape(kv[0])
+			value, verr := url.QueryUnescape(kv[1])
+
+			if m := rePageParam.FindStringSubmatch(key); m != nil && kerr == nil && verr == nil {
+				if _, err := strconv.Atoi(value); err != nil {
+					cursors[m[1]] = value
+					continue
+				}
+			}
+		}
+
+		terms = append(terms, term)
+	}
+
+	qo, err := queryoptions.FromQuerystring(strings.Join(terms, "&"))
+	if err != nil {
+		return queryoptions.Options{}, nil, err
+	}
+
+	return qo, cursors, nil
+}
+
+// escapeValues URL encodes and joins the values of a parameter with commas...
+// values that contain a comma cannot be represented because the values of
+// each parameter are split on commas when parsed
+func escapeValues(param string, field string, values []string) (string, error) {
+	escaped := []string{}
+	for _, value := range values {
+		if strings.Contains(value, ",") {
+			if field != "" {
+				param = fmt.Sprintf("%s[%s]", param, field)
+			}
+			return "", fmt.Errorf("invalid value %s for %s, values containing a comma can not be serialised", value, param)
+		}
+
+		escaped = append(escaped, url.QueryEscape(value))
+	}
+
+	return strings.Join(escaped, ","), nil
+}
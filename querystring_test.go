@@ -0,0 +1,135 @@
+package querybuilder
+
+import (
+	"reflect"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+)
+
+func TestQuerystring(t *testing.T) {
+	qb := QueryBuilder{
+		collection: "test",
+		fieldTypes: map[string]string{
+			"age":     "int",
+			"created": "date",
+			"name":    "string",
+			"status":  "string",
+			"tags":    "array",
+		},
+	}
+
+	tests := []struct {
+		name    string
+		qo      queryoptions.Options
+		cursors map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "should serialise empty options",
+			qo:   queryoptions.Options{},
+			want: "",
+		},
+		{
+			name: "should order filter and page parameters and sort fields",
+			qo: queryoptions.Options{
+				Fields: []string{"status", "name"},
+				Filter: map[string][]string{
+					"status": {"active"},
+					"age":    {">=18", "<65"},
+				},
+				Page: map[string]int{"offset": 20, "limit": 10},
+				Sort: []string{"-name", "age"},
+			},
+			want: "filter[age]=%3E%3D18,%3C65&filter[status]=active&fields=name,status&page[limit]=10&page[offset]=20&sort=-name,age",
+		},
+		{
+			name: "should serialise every page parameter",
+			qo: queryoptions.Options{
+				Page: map[string]int{"size": 10, "after": 42},
+				Sort: []string{"age"},
+			},
+			want: "page[after]=42&page[size]=10&sort=age",
+		},
+		{
+			name: "should serialise cursor tokens with the page parameters",
+			qo: queryoptions.Options{
+				Page: map[string]int{"size": 10},
+				Sort: []string{"age"},
+			},
+			cursors: map[string]string{"after": "eyJpZCI6NDJ9+/="},
+			want:    "page[after]=eyJpZCI6NDJ9%2B%2F%3D&page[size]=10&sort=age",
+		},
+		{
+			name: "should reject cursor tokens for page parameters that are set",
+			qo: queryoptions.Options{
+				Page: map[string]int{"after": 42},
+			},
+			cursors: map[string]string{"after": "eyJpZCI6NDJ9"},
+			wantErr: true,
+		},
+		{
+			name: "should encode values and field modifiers",
+			qo: queryoptions.Options{
+				Filter: map[string][]string{
+					"created:month": {"2"},
+					"name":          {"ba s*", "a&b"},
+				},
+			},
+			want: "filter[created%3Amonth]=2&filter[name]=ba+s%2A,a%26b",
+		},
+		{
+			name: "should reject values containing commas",
+			qo: queryoptions.Options{
+				Filter: map[string][]string{"name": {"a,b"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Querystring(tt.qo, tt.cursors)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Querystring() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("Querystring() = %v, want %v", got, tt.want)
+			}
+
+			// the querystring should parse to the same filter, options and cursors
+			qo, cursors, err := ParseQuerystring(got)
+			if err != nil {
+				t.Errorf("ParseQuerystring() error = %v", err)
+				return
+			}
+
+			if len(cursors) > 0 || len(tt.cursors) > 0 {
+				if !reflect.DeepEqual(cursors, tt.cursors) {
+					t.Errorf("ParseQuerystring() cursors = %v, want %v", cursors, tt.cursors)
+				}
+			}
+
+			want, _ := qb.FilterD(tt.qo)
+			if filter, _ := qb.FilterD(qo); !reflect.DeepEqual(filter, want) {
+				t.Errorf("QueryBuilder.FilterD() = %v, want %v", filter, want)
+			}
+
+			wantOpts, _ := qb.Shell(tt.qo)
+			if opts, _ := qb.Shell(qo); opts != wantOpts {
+				t.Errorf("QueryBuilder.Shell() = %v, want %v", opts, wantOpts)
+			}
+
+			// and serialise to the same querystring
+			if again, _ := Querystring(qo, cursors); again != got {
+				t.Errorf("Querystring() = %v, want %v", again, got)
+			}
+		})
+	}
+}
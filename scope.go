@@ -0,0 +1,70 @@
+package querybuilder
+
+import (
+	"context"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Scope returns a filter clause that must be applied to every query built by
+// the QueryBuilder (i.e. restricting results to the tenant of the caller
+// identified within the provided context)
+type Scope func(ctx context.Context) (bson.M, error)
+
+// AddScope registers a static clause (i.e. bson.M{"deletedAt": nil}) that is
+// always ANDed with filters and pipelines built by the QueryBuilder. Scope
+// clauses reference stored paths rather than public field names.
+func (qb *QueryBuilder) AddScope(clause bson.M) *QueryBuilder {
+	return qb.AddScopeFunc(func(ctx context.Context) (bson.M, error) {
+		return clause, nil
+	})
+}
+
+// AddScopeFunc registers a clause, computed from the context of each request,
+// that is always ANDed with filters and pipelines built by the QueryBuilder.
+// When the Scope returns an error, the filter is not built.
+func (qb *QueryBuilder) AddScopeFunc(scope Scope) *QueryBuilder {
+	qb.scopes = append(qb.scopes, scope)
+
+	return qb
+}
+
+// applyScopes ANDs each of the registered scope clauses with the filter... when
+// the filter already contains a clause for the same field, the scope clause is
+// added to an $and so that the user filter cannot override it
+func (qb QueryBuilder) applyScopes(ctx context.Context, filter bson.M) (bson.M, error) {
+	for _, scope := range qb.scopes {
+		clause, err := scope(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for field, value := range clause {
+			if _, ok := filter[field]; !ok && !strings.HasPrefix(field, "$") {
+				filter[field] = value
+				continue
+			}
+
+			and, _ := filter["$and"].(bson.A)
+			filter["$and"] = append(and, bson.M{field: value})
+		}
+	}
+
+	return filter, nil
+}
+
+// scopeNodes parses each of the registered scope clauses into nodes of an AST
+func (qb QueryBuilder) scopeNodes(ctx context.Context) ([]Node, error) {
+	nodes := []Node{}
+	for _, scope := range qb.scopes {
+		clause, err := scope(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, parseClause(clause)...)
+	}
+
+	return nodes, nil
+}
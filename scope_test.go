@@ -0,0 +1,140 @@
+package querybuilder
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type tenantKey struct{}
+
+func testTenantScope(ctx context.Context) (bson.M, error) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	if !ok {
+		return nil, errors.New("tenant is required")
+	}
+
+	return bson.M{"tenantId": tenant}, nil
+}
+
+func TestQueryBuilder_AddScope(t *testing.T) {
+	fieldTypes := map[string]string{
+		"name":     "string",
+		"tenantId": "string",
+	}
+
+	tests := []struct {
+		name    string
+		tenant  string
+		qs      string
+		want    bson.M
+		wantErr bool
+	}{
+		{
+			name:   "should apply scopes when no filter is provided",
+			tenant: "t1",
+			qs:     "",
+			want: bson.M{
+				"tenantId":  "t1",
+				"deletedAt": nil,
+			},
+		},
+		{
+			name:   "should AND scopes with user filters",
+			tenant: "t1",
+			qs:     "filter[name]=bob",
+			want: bson.M{
+				"name":      "bob",
+				"tenantId":  "t1",
+				"deletedAt": nil,
+			},
+		},
+		{
+			name:   "should not allow user filters to override scopes",
+			tenant: "t1",
+			qs:     "filter[tenantId]=t2",
+			want: bson.M{
+				"tenantId":  "t2",
+				"deletedAt": nil,
+				"$and": bson.A{
+					bson.M{"tenantId": "t1"},
+				},
+			},
+		},
+		{
+			name:    "should return scope errors",
+			qs:      "filter[name]=bob",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := (&QueryBuilder{
+				collection: "test",
+				fieldTypes: fieldTypes,
+			}).AddScope(bson.M{"deletedAt": nil}).AddScopeFunc(testTenantScope)
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			ctx := context.Background()
+			if tt.tenant != "" {
+				ctx = context.WithValue(ctx, tenantKey{}, tt.tenant)
+			}
+
+			got, err := qb.FilterContext(ctx, qo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryBuilder.FilterContext() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("QueryBuilder.FilterContext() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryBuilder_Pipeline(t *testing.T) {
+	var el int64 = 10
+
+	qb := (&QueryBuilder{
+		collection: "test",
+		fieldTypes: map[string]string{
+			"name": "string",
+		},
+	}).AddScope(bson.M{"deletedAt": nil})
+
+	qo := queryoptions.Options{
+		Filter: map[string][]string{"name": {"bob"}},
+		Fields: []string{"name"},
+		Page:   map[string]int{"limit": 10, "offset": 10},
+		Sort:   []string{"-name"},
+	}
+
+	want := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"name": "bob", "deletedAt": nil}}},
+		{{Key: "$sort", Value: bson.D{{Key: "name", Value: -1}}}},
+		{{Key: "$skip", Value: el}},
+		{{Key: "$limit", Value: el}},
+		{{Key: "$project", Value: map[string]int{"name": 1}}},
+	}
+
+	got, err := qb.Pipeline(qo)
+	if err != nil {
+		t.Errorf("QueryBuilder.Pipeline() error = %v", err)
+		return
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("QueryBuilder.Pipeline() = %v, want %v", got, want)
+	}
+}
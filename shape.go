@@ -0,0 +1,263 @@
+package querybuilder
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Shape returns the normalised shape of the query described by the query
+// options: the canonical filter (see Canonical) along with the sort and
+// projection built by FindOptions, with the values replaced by a placeholder
+// for their type (i.e. ?number or ?array<?string>)... as with query shapes in
+// MongoDB, queries that differ only by their values have the same shape
+func (qb QueryBuilder) Shape(qo queryoptions.Options) (bson.D, error) {
+	return qb.ShapeContext(context.Background(), qo)
+}
+
+// ShapeContext returns the normalised shape of the query in the same manner as
+// Shape, applying any field policy configured for the QueryBuilder to the
+// caller identified by the provided context
+func (qb QueryBuilder) ShapeContext(ctx context.Context, qo queryoptions.Options) (bson.D, error) {
+	filter, err := qb.FilterDContext(ctx, qo)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := qb.FindOptionsContext(ctx, qo)
+	if err != nil {
+		return nil, err
+	}
+
+	shape := bson.D{
+		{Key: "collection", Value: qb.collection},
+		{Key: "filter", Value: shapeFilter(filter)},
+	}
+
+	// the order of sort keys is significant
+	if sort, ok := opts.Sort.(bson.D); ok && len(sort) > 0 {
+		d := bson.D{}
+		for _, e := range sort {
+			d = append(d, primitive.E{Key: e.Key, Value: canonicalValue(e.Key, e.Value)})
+		}
+		shape = append(shape, primitive.E{Key: "sort", Value: d})
+	}
+
+	if projection := canonicalProjection(opts.Projection); len(projection) > 0 {
+		shape = append(shape, primitive.E{Key: "projection", Value: projection})
+	}
+
+	if opts.Skip != nil {
+		shape = append(shape, primitive.E{Key: "skip", Value: "?number"})
+	}
+
+	if opts.Limit != nil {
+		shape = append(shape, primitive.E{Key: "limit", Value: "?number"})
+	}
+
+	return shape, nil
+}
+
+// Fingerprint returns a stable hash (hex encoded SHA-256) of the shape of the
+// query (see Shape) that can be used to group queries regardless of values
+func (qb QueryBuilder) Fingerprint(qo queryoptions.Options) (string, error) {
+	return qb.FingerprintContext(context.Background(), qo)
+}
+
+// FingerprintContext returns a stable hash of the shape of the query in the
+// same manner as Fingerprint, applying any field policy configured for the
+// QueryBuilder to the caller identified by the provided context
+func (qb QueryBuilder) FingerprintContext(ctx context.Context, qo queryoptions.Options) (string, error) {
+	shape, err := qb.ShapeContext(ctx, qo)
+	if err != nil {
+		return "", err
+	}
+
+	encoded, err := bson.Marshal(shape)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(encoded)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// shapeFilter replaces the values of a canonical filter with placeholders
+func shapeFilter(filter bson.D) bson.D {
+	shape := bson.D{}
+
+	for _, e := range filter {
+		var v interface{}
+
+		switch {
+		case e.Key == "$and" || e.Key == "$or" || e.Key == "$nor":
+			v = shapeClauses(e.Value)
+		case e.Key == "$expr":
+			v = shapeExpr(e.Value)
+		default:
+			v = shapeOperand(e.Value)
+		}
+
+		shape = append(shape, primitive.E{Key: e.Key, Value: v})
+	}
+
+	return shape
+}
+
+// shapeClauses shapes each of the clauses of a logical operator, sorting the
+// shapes so that the order of the clauses is not significant
+func shapeClauses(v interface{}) interface{} {
+	a, ok := v.(bson.A)
+	if !ok {
+		return shapeLiteral(v)
+	}
+
+	type encodedShape struct {
+		encoded []byte
+		shape   bson.D
+	}
+
+	shapes := []encodedShape{}
+	for _, clause := range a {
+		d, ok := clause.(bson.D)
+		if !ok {
+			continue
+		}
+
+		shape := shapeFilter(d)
+		encoded, _ := bson.Marshal(shape)
+		shapes = append(shapes, encodedShape{encoded, shape})
+	}
+
+	sort.SliceStable(shapes, func(i, j int) bool {
+		return bytes.Compare(shapes[i].encoded, shapes[j].encoded) < 0
+	})
+
+	sorted := bson.A{}
+	for _, s := range shapes {
+		sorted = append(sorted, s.shape)
+	}
+
+	return sorted
+}
+
+// shapeOperand replaces the values of an operator document (or the value a
+// field is compared with) with placeholders
+func shapeOperand(v interface{}) interface{} {
+	d, ok := v.(bson.D)
+	if !ok || !isOperatorDocument(d.Map()) {
+		return shapeLiteral(v)
+	}
+
+	shape := bson.D{}
+	for _, e := range d {
+		var value interface{}
+
+		switch e.Key {
+		case "$elemMatch":
+			if inner, ok := e.Value.(bson.D); ok && !isOperatorDocument(inner.Map()) {
+				value = shapeFilter(inner)
+			} else {
+				value = shapeOperand(e.Value)
+			}
+		case "$not":
+			value = shapeOperand(e.Value)
+		default:
+			value = shapeLiteral(e.Value)
+		}
+
+		shape = append(shape, primitive.E{Key: e.Key, Value: value})
+	}
+
+	return shape
+}
+
+// shapeExpr replaces the values of an aggregation expression with placeholders,
+// retaining the fields that are referenced (i.e. "$startDate")
+func shapeExpr(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if strings.HasPrefix(v, "$") {
+			return v
+		}
+	case bson.D:
+		shape := bson.D{}
+		for _, e := range v {
+			shape = append(shape, primitive.E{Key: e.Key, Value: shapeExpr(e.Value)})
+		}
+		return shape
+	case bson.A:
+		shape := bson.A{}
+		for _, value := range v {
+			shape = append(shape, shapeExpr(value))
+		}
+		return shape
+	}
+
+	return shapeLiteral(v)
+}
+
+// shapeLiteral returns the placeholder for the type of a value
+func shapeLiteral(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "?null"
+	case string:
+		return "?string"
+	case bool:
+		return "?bool"
+	case int, int32, int64, float32, float64, primitive.Decimal128:
+		return "?number"
+	case time.Time, *time.Time, primitive.DateTime, primitive.Timestamp:
+		if t, ok := v.(*time.Time); ok && t == nil {
+			return "?null"
+		}
+		return "?date"
+	case primitive.ObjectID:
+		return "?objectId"
+	case primitive.Regex:
+		return "?regex"
+	case bson.D, bson.M:
+		return "?object"
+	case bson.A:
+		return shapeArray(v)
+	}
+
+	// other slices (i.e. coordinates)
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice {
+		a := bson.A{}
+		for i := 0; i < rv.Len(); i++ {
+			a = append(a, rv.Index(i).Interface())
+		}
+		return shapeArray(a)
+	}
+
+	return fmt.Sprintf("?%T", v)
+}
+
+// shapeArray returns the placeholder for an array, which includes the type of
+// the items when all items have the same type (regardless of their number)
+func shapeArray(a bson.A) string {
+	item := ""
+	for i, value := range a {
+		shape := shapeLiteral(value)
+		if i > 0 && shape != item {
+			return "?array<>"
+		}
+		item = shape
+	}
+
+	return fmt.Sprintf("?array<%s>", item)
+}
@@ -0,0 +1,114 @@
+package querybuilder
+
+import (
+	"reflect"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQueryBuilder_Shape(t *testing.T) {
+	qb := QueryBuilder{
+		collection: "test",
+		fieldTypes: map[string]string{
+			"age":     "int",
+			"created": "date",
+			"name":    "string",
+			"status":  "string",
+		},
+	}
+
+	qo, err := queryoptions.FromQuerystring("filter[age]=1,2,3&filter[name]=bob*&filter[status]=||a&filter[created]=>$created&sort=-age&fields=name&page[offset]=10&page[limit]=5")
+	if err != nil {
+		t.Errorf("options.FromQuerystring() error = %v", err)
+		return
+	}
+
+	want := bson.D{
+		{Key: "collection", Value: "test"},
+		{Key: "filter", Value: bson.D{
+			{Key: "$expr", Value: bson.D{{Key: "$gt", Value: bson.A{"$created", "$created"}}}},
+			{Key: "$or", Value: bson.A{bson.D{{Key: "status", Value: "?string"}}}},
+			{Key: "age", Value: bson.D{{Key: "$in", Value: "?array<?number>"}}},
+			{Key: "name", Value: "?regex"},
+		}},
+		{Key: "sort", Value: bson.D{{Key: "age", Value: -1}}},
+		{Key: "projection", Value: bson.D{{Key: "name", Value: 1}}},
+		{Key: "skip", Value: "?number"},
+		{Key: "limit", Value: "?number"},
+	}
+
+	got, err := qb.Shape(qo)
+	if err != nil {
+		t.Errorf("QueryBuilder.Shape() error = %v", err)
+		return
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("QueryBuilder.Shape() = %v, want %v", got, want)
+	}
+}
+
+func TestQueryBuilder_Fingerprint(t *testing.T) {
+	qb := QueryBuilder{
+		collection: "test",
+		fieldTypes: map[string]string{
+			"age":  "int",
+			"name": "string",
+		},
+	}
+
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want bool
+	}{
+		{
+			name: "should match queries that differ only by values",
+			a:    "filter[age]=1,2&filter[name]=bob&sort=name",
+			b:    "filter[name]=alice&filter[age]=7,8,9&sort=name",
+			want: true,
+		},
+		{
+			name: "should not match queries with different operators",
+			a:    "filter[age]=>1",
+			b:    "filter[age]=<1",
+		},
+		{
+			name: "should not match queries with different sorts",
+			a:    "filter[age]=1&sort=name,age",
+			b:    "filter[age]=1&sort=age,name",
+		},
+		{
+			name: "should not match queries with different types of values",
+			a:    "filter[name]=bob",
+			b:    "filter[name]=*bob*",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fingerprints []string
+			for _, qs := range []string{tt.a, tt.b} {
+				qo, err := queryoptions.FromQuerystring(qs)
+				if err != nil {
+					t.Errorf("options.FromQuerystring() error = %v", err)
+					return
+				}
+
+				fp, err := qb.Fingerprint(qo)
+				if err != nil {
+					t.Errorf("QueryBuilder.Fingerprint() error = %v", err)
+					return
+				}
+
+				fingerprints = append(fingerprints, fp)
+			}
+
+			if got := fingerprints[0] == fingerprints[1]; got != tt.want {
+				t.Errorf("QueryBuilder.Fingerprint() match = %v, want %v (%v)", got, tt.want, fingerprints)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package querybuilder
+
+import (
+	"context"
+	"fmt"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SetSortTiebreaker configures a unique field (typically _id) that is appended
+// to every sort that does not already include it, using the direction of the
+// last sort key, so that paging over non-unique fields does not return
+// duplicates or skip documents
+func (qb *QueryBuilder) SetSortTiebreaker(field string) *QueryBuilder {
+	qb.sortTiebreaker = field
+
+	return qb
+}
+
+// SetDefaultSort configures the sort (using the same syntax as the sort
+// querystring parameter, i.e. "-created") applied when no sort is provided
+func (qb *QueryBuilder) SetDefaultSort(fields ...string) *QueryBuilder {
+	qb.defaultSort = fields
+
+	return qb
+}
+
+// SetCollation configures the collation (i.e. locale, strength and numeric
+// ordering) applied to FindOptions and AggregateOptions built by the
+// QueryBuilder
+func (qb *QueryBuilder) SetCollation(collation *options.Collation) *QueryBuilder {
+	qb.collation = collation
+
+	return qb
+}
+
+// SetFieldCollation configures a collation for a specific field... because
+// MongoDB applies a single collation to each operation, the collation for the
+// first sort key that has one takes precedence over the collation configured
+// with SetCollation
+func (qb *QueryBuilder) SetFieldCollation(field string, collation *options.Collation) *QueryBuilder {
+	if qb.fieldCollations == nil {
+		qb.fieldCollations = map[string]*options.Collation{}
+	}
+
+	qb.fieldCollations[field] = collation
+
+	return qb
+}
+
+// AggregateOptions creates a mongo.AggregateOptions struct with the collation
+// suitable for the pipeline built by Pipeline for the query options
+func (qb QueryBuilder) AggregateOptions(qo queryoptions.Options) (*options.AggregateOptions, error) {
+	return qb.AggregateOptionsContext(context.Background(), qo)
+}
+
+// AggregateOptionsContext creates a mongo.AggregateOptions struct in the same
+// manner as AggregateOptions for the caller identified by the provided context
+func (qb QueryBuilder) AggregateOptionsContext(ctx context.Context, qo queryoptions.Options) (*options.AggregateOptions, error) {
+	fo, err := qb.FindOptionsContext(ctx, qo)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Aggregate()
+	if fo.Collation != nil {
+		opts.SetCollation(fo.Collation)
+	}
+
+	return opts, nil
+}
+
+// appendSortTiebreaker adds the tiebreaker field to the end of the sort when
+// it is not already sorted on
+func (qb QueryBuilder) appendSortTiebreaker(sort bson.D) bson.D {
+	if qb.sortTiebreaker == "" || len(sort) == 0 {
+		return sort
+	}
+
+	for _, e := range sort {
+		if e.Key == qb.sortTiebreaker {
+			return sort
+		}
+	}
+
+	// use the direction of the last sort key (relevance is always descending)
+	direction := -1
+	if val, ok := sort[len(sort)-1].Value.(int); ok {
+		direction = val
+	}
+
+	return append(sort, bson.E{Key: qb.sortTiebreaker, Value: direction})
+}
+
+// sortCollation returns the collation of the first sort key that has a field
+// collation, otherwise the collation of the QueryBuilder
+func (qb QueryBuilder) sortCollation(sort interface{}) *options.Collation {
+	if keys, ok := sort.(bson.D); ok {
+		for _, e := range keys {
+			for field, collation := range qb.fieldCollations {
+				if qb.storedField(field) == e.Key {
+					return collation
+				}
+			}
+		}
+	}
+
+	return qb.collation
+}
+
+// SetInsensitiveMatching configures exact and $in string filters to be
+// compared using a collation with the provided strength (1 ignores case and
+// diacritics, 2 ignores case only) instead of regular expressions, so that
+// filter[name]="jose" matches José and can use a case-insensitive index. The
+// collation is attached to the FindOptions, AggregateOptions and CountOptions
+// built by the QueryBuilder, using the locale of the configured collation
+// (or "en" when no collation is configured). Strengths other than 1 or 2
+// compare case and would not match insensitively, so Filter, FindOptions,
+// AggregateOptions and CountOptions return an error when one is configured.
+func (qb *QueryBuilder) SetInsensitiveMatching(strength int) *QueryBuilder {
+	qb.matchStrength = strength
+
+	return qb
+}
+
+// CountOptions creates a mongo.CountOptions struct with the collation used by
+// the FindOptions built for the query options (including any field collation
+// of the sort and the strength used for string matching), so that counting
+// the documents matching a filter built by the QueryBuilder matches the same
+// documents as finding them
+func (qb QueryBuilder) CountOptions(qo queryoptions.Options) (*options.CountOptions, error) {
+	return qb.CountOptionsContext(context.Background(), qo)
+}
+
+// CountOptionsContext creates a mongo.CountOptions struct in the same manner
+// as CountOptions for the caller identified by the provided context
+func (qb QueryBuilder) CountOptionsContext(ctx context.Context, qo queryoptions.Options) (*options.CountOptions, error) {
+	fo, err := qb.FindOptionsContext(ctx, qo)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Count()
+	if fo.Collation != nil {
+		opts.SetCollation(fo.Collation)
+	}
+
+	return opts, nil
+}
+
+// checkMatchStrength ensures the strength configured for insensitive matching
+// ignores case
+func (qb QueryBuilder) checkMatchStrength() error {
+	if qb.matchStrength != 0 && qb.matchStrength != 1 && qb.matchStrength != 2 {
+		return fmt.Errorf("insensitive matching requires a collation strength of 1 or 2, not %d", qb.matchStrength)
+	}
+
+	return nil
+}
+
+// matchCollation applies the strength configured for insensitive matching to
+// a copy of the provided collation
+func (qb QueryBuilder) matchCollation(collation *options.Collation) (*options.Collation, error) {
+	if err := qb.checkMatchStrength(); err != nil {
+		return nil, err
+	}
+
+	if qb.matchStrength == 0 {
+		return collation, nil
+	}
+
+	c := options.Collation{Locale: "en"}
+	if collation != nil {
+		c = *collation
+	}
+
+	c.Strength = qb.matchStrength
+
+	return &c, nil
+}
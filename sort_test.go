@@ -0,0 +1,215 @@
+package querybuilder
+
+import (
+	"reflect"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestQueryBuilder_SetSortTiebreaker(t *testing.T) {
+	english := &options.Collation{Locale: "en", Strength: 2}
+	numeric := &options.Collation{Locale: "en", NumericOrdering: true}
+
+	tests := []struct {
+		name          string
+		sort          []string
+		wantSort      interface{}
+		wantCollation *options.Collation
+	}{
+		{
+			name:          "should apply default sort and tiebreaker when no sort is provided",
+			wantSort:      bson.D{{Key: "created", Value: -1}, {Key: "_id", Value: -1}},
+			wantCollation: english,
+		},
+		{
+			name:          "should append tiebreaker using the direction of the last sort key",
+			sort:          []string{"-created", "name"},
+			wantSort:      bson.D{{Key: "created", Value: -1}, {Key: "name", Value: 1}, {Key: "_id", Value: 1}},
+			wantCollation: english,
+		},
+		{
+			name:          "should not append tiebreaker when already sorted on",
+			sort:          []string{"-_id"},
+			wantSort:      bson.D{{Key: "_id", Value: -1}},
+			wantCollation: english,
+		},
+		{
+			name:          "should apply the field collation of the first sort key",
+			sort:          []string{"created", "code"},
+			wantSort:      bson.D{{Key: "created", Value: 1}, {Key: "code", Value: 1}, {Key: "_id", Value: 1}},
+			wantCollation: numeric,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := (&QueryBuilder{
+				collection: "test",
+				fieldTypes: map[string]string{},
+			}).
+				SetSortTiebreaker("_id").
+				SetDefaultSort("-created").
+				SetCollation(english).
+				SetFieldCollation("code", numeric)
+
+			got, err := qb.FindOptions(queryoptions.Options{Sort: tt.sort})
+			if err != nil {
+				t.Errorf("QueryBuilder.FindOptions() error = %v", err)
+				return
+			}
+
+			if !reflect.DeepEqual(got.Sort, tt.wantSort) {
+				t.Errorf("QueryBuilder.FindOptions() sort = %v, want %v", got.Sort, tt.wantSort)
+			}
+
+			if got.Collation != tt.wantCollation {
+				t.Errorf("QueryBuilder.FindOptions() collation = %v, want %v", got.Collation, tt.wantCollation)
+			}
+
+			ao, err := qb.AggregateOptions(queryoptions.Options{Sort: tt.sort})
+			if err != nil {
+				t.Errorf("QueryBuilder.AggregateOptions() error = %v", err)
+				return
+			}
+
+			if ao.Collation != tt.wantCollation {
+				t.Errorf("QueryBuilder.AggregateOptions() collation = %v, want %v", ao.Collation, tt.wantCollation)
+			}
+		})
+	}
+}
+
+func TestQueryBuilder_SetInsensitiveMatching(t *testing.T) {
+	qb := (&QueryBuilder{
+		collection: "test",
+		fieldTypes: map[string]string{
+			"name": "string",
+		},
+	}).SetInsensitiveMatching(1)
+
+	qo, err := queryoptions.FromQuerystring("filter[name]=\"jose\"")
+	if err != nil {
+		t.Errorf("options.FromQuerystring() error = %v", err)
+		return
+	}
+
+	f, err := qb.Filter(qo)
+	if err != nil {
+		t.Errorf("QueryBuilder.Filter() error = %v", err)
+		return
+	}
+
+	if want := (bson.M{"name": "jose"}); !reflect.DeepEqual(f, want) {
+		t.Errorf("QueryBuilder.Filter() = %v, want %v", f, want)
+	}
+
+	want := &options.Collation{Locale: "en", Strength: 1}
+
+	fo, err := qb.FindOptions(qo)
+	if err != nil {
+		t.Errorf("QueryBuilder.FindOptions() error = %v", err)
+		return
+	}
+
+	if !reflect.DeepEqual(fo.Collation, want) {
+		t.Errorf("QueryBuilder.FindOptions() collation = %v, want %v", fo.Collation, want)
+	}
+
+	co, err := qb.SetCollation(&options.Collation{Locale: "fr"}).CountOptions(qo)
+	if err != nil {
+		t.Errorf("QueryBuilder.CountOptions() error = %v", err)
+		return
+	}
+
+	want = &options.Collation{Locale: "fr", Strength: 1}
+	if !reflect.DeepEqual(co.Collation, want) {
+		t.Errorf("QueryBuilder.CountOptions() collation = %v, want %v", co.Collation, want)
+	}
+}
+
+func TestQueryBuilder_SetInsensitiveMatching_strength(t *testing.T) {
+	for _, strength := range []int{-1, 3, 5} {
+		qb := (&QueryBuilder{
+			fieldTypes: map[string]string{"name": "string"},
+		}).SetInsensitiveMatching(strength)
+
+		qo := queryoptions.Options{Filter: map[string][]string{"name": {"\"jose\""}}}
+
+		if _, err := qb.Filter(qo); err == nil {
+			t.Errorf("QueryBuilder.Filter() with strength %d did not error", strength)
+		}
+
+		if _, err := qb.FindOptions(qo); err == nil {
+			t.Errorf("QueryBuilder.FindOptions() with strength %d did not error", strength)
+		}
+
+		if _, err := qb.CountOptions(qo); err == nil {
+			t.Errorf("QueryBuilder.CountOptions() with strength %d did not error", strength)
+		}
+	}
+}
+
+func TestQueryBuilder_CountOptions(t *testing.T) {
+	qb := (&QueryBuilder{
+		fieldTypes: map[string]string{
+			"age":  "int",
+			"name": "string",
+		},
+	}).
+		SetCollation(&options.Collation{Locale: "en"}).
+		SetFieldCollation("name", &options.Collation{Locale: "sv"}).
+		SetInsensitiveMatching(2)
+
+	tests := []struct {
+		name             string
+		strictValidation bool
+		qs               string
+		want             *options.Collation
+		wantErr          bool
+	}{
+		{
+			name: "should use the collation of the query builder",
+			qs:   "filter[name]=\"jose\"&sort=age",
+			want: &options.Collation{Locale: "en", Strength: 2},
+		},
+		{
+			name: "should use the field collation of the sort",
+			qs:   "filter[name]=\"jose\"&sort=name",
+			want: &options.Collation{Locale: "sv", Strength: 2},
+		},
+		{
+			name:             "should return an error for invalid query options",
+			strictValidation: true,
+			qs:               "sort=unknown",
+			wantErr:          true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			qb := *qb
+			qb.strictValidation = tt.strictValidation
+
+			got, err := qb.CountOptions(qo)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("QueryBuilder.CountOptions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(got.Collation, tt.want) {
+				t.Errorf("QueryBuilder.CountOptions() collation = %v, want %v", got.Collation, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package querybuilder
+
+import (
+	"strings"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultTextSearchFilter = "$search"
+	defaultTextScoreField   = "score"
+	textScoreSort           = "$score"
+)
+
+var textScore = bson.M{"$meta": "textScore"}
+
+// TextSearch configures keyword search using a $text query (the collection
+// requires a text index)
+type TextSearch struct {
+	// Filter is the name of the filter used for keyword search (defaults to
+	// $search, i.e. filter[$search]=term)
+	Filter string
+
+	// Language determines the stop words, stemmer and tokenizer for the search
+	// (defaults to the language of the text index)
+	Language string
+
+	// CaseSensitive enables case sensitive search
+	CaseSensitive bool
+
+	// DiacriticSensitive enables diacritic sensitive search
+	DiacriticSensitive bool
+
+	// ScoreField is the name of the field the relevance score is projected to
+	// (defaults to score)
+	ScoreField string
+}
+
+// SetTextSearch enables keyword search... values provided for the search
+// filter are turned into a $text query, the relevance score of each document
+// is projected and sort=$score sorts the results by relevance
+func (qb *QueryBuilder) SetTextSearch(search TextSearch) *QueryBuilder {
+	qb.textSearch = &search
+
+	return qb
+}
+
+func (qb QueryBuilder) isTextSearchFilter(field string) bool {
+	if qb.textSearch == nil {
+		return false
+	}
+
+	if qb.textSearch.Filter == "" {
+		return field == defaultTextSearchFilter
+	}
+
+	return field == qb.textSearch.Filter
+}
+
+func (qb QueryBuilder) isTextScoreSort(field string) bool {
+	return qb.textSearch != nil && field == textScoreSort
+}
+
+func (qb QueryBuilder) textScoreField() string {
+	if qb.textSearch == nil || qb.textSearch.ScoreField == "" {
+		return defaultTextScoreField
+	}
+
+	return qb.textSearch.ScoreField
+}
+
+// textSearchFilter creates a $text condition for the search terms
+func (qb QueryBuilder) textSearchFilter(values []string) Condition {
+	text := bson.D{{Key: "$search", Value: strings.Join(values, " ")}}
+
+	if qb.textSearch.Language != "" {
+		text = append(text, bson.E{Key: "$language", Value: qb.textSearch.Language})
+	}
+
+	if qb.textSearch.CaseSensitive {
+		text = append(text, bson.E{Key: "$caseSensitive", Value: true})
+	}
+
+	if qb.textSearch.DiacriticSensitive {
+		text = append(text, bson.E{Key: "$diacriticSensitive", Value: true})
+	}
+
+	return Condition{Operator: "$text", Value: text}
+}
+
+// setTextScoreOptions adds the relevance score to the projection when the
+// query options use keyword search or sort by relevance
+func (qb QueryBuilder) setTextScoreOptions(qo queryoptions.Options, opts *options.FindOptions) {
+	if qb.textSearch == nil {
+		return
+	}
+
+	searched := false
+	for field := range qo.Filter {
+		searched = searched || qb.isTextSearchFilter(field)
+	}
+
+	for _, field := range qo.Sort {
+		searched = searched || qb.isTextScoreSort(strings.TrimLeft(field, "+-"))
+	}
+
+	if !searched {
+		return
+	}
+
+	prj := bson.M{}
+	if fields, ok := opts.Projection.(map[string]int); ok {
+		for field, val := range fields {
+			prj[field] = val
+		}
+	}
+
+	prj[qb.textScoreField()] = textScore
+	opts.SetProjection(prj)
+}
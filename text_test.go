@@ -0,0 +1,85 @@
+package querybuilder
+
+import (
+	"reflect"
+	"testing"
+
+	queryoptions "go.jtlabs.io/query"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestQueryBuilder_SetTextSearch(t *testing.T) {
+	tests := []struct {
+		name           string
+		search         TextSearch
+		qs             string
+		wantFilter     bson.M
+		wantSort       interface{}
+		wantProjection interface{}
+	}{
+		{
+			name:   "should build a $text query for the search filter",
+			search: TextSearch{},
+			qs:     "filter[$search]=coffee,shop&filter[name]=bob",
+			wantFilter: bson.M{
+				"$text": bson.D{{Key: "$search", Value: "coffee shop"}},
+				"name":  "bob",
+			},
+			wantProjection: bson.M{"score": textScore},
+		},
+		{
+			name:   "should support a configurable filter name and search options",
+			search: TextSearch{Filter: "q", Language: "es", CaseSensitive: true, DiacriticSensitive: true, ScoreField: "relevance"},
+			qs:     "filter[q]=café&sort=$score&fields=name",
+			wantFilter: bson.M{
+				"$text": bson.D{
+					{Key: "$search", Value: "café"},
+					{Key: "$language", Value: "es"},
+					{Key: "$caseSensitive", Value: true},
+					{Key: "$diacriticSensitive", Value: true},
+				},
+			},
+			wantSort:       bson.D{{Key: "relevance", Value: textScore}, {Key: "_id", Value: -1}},
+			wantProjection: bson.M{"name": 1, "relevance": textScore},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qb := (&QueryBuilder{
+				collection:       "test",
+				fieldTypes:       map[string]string{"name": "string"},
+				strictValidation: true,
+			}).SetTextSearch(tt.search).SetSortTiebreaker("_id")
+
+			qo, err := queryoptions.FromQuerystring(tt.qs)
+			if err != nil {
+				t.Errorf("options.FromQuerystring() error = %v", err)
+				return
+			}
+
+			f, err := qb.Filter(qo)
+			if err != nil {
+				t.Errorf("QueryBuilder.Filter() error = %v", err)
+				return
+			}
+
+			if !reflect.DeepEqual(f, tt.wantFilter) {
+				t.Errorf("QueryBuilder.Filter() = %v, want %v", f, tt.wantFilter)
+			}
+
+			fo, err := qb.FindOptions(qo)
+			if err != nil {
+				t.Errorf("QueryBuilder.FindOptions() error = %v", err)
+				return
+			}
+
+			if !reflect.DeepEqual(fo.Sort, tt.wantSort) {
+				t.Errorf("QueryBuilder.FindOptions() sort = %v, want %v", fo.Sort, tt.wantSort)
+			}
+
+			if !reflect.DeepEqual(fo.Projection, tt.wantProjection) {
+				t.Errorf("QueryBuilder.FindOptions() projection = %v, want %v", fo.Projection, tt.wantProjection)
+			}
+		})
+	}
+}